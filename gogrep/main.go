@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/alecthomas/kong"
@@ -25,8 +30,10 @@ var submatchColors = []*color.Color{
 }
 
 var cli struct {
-	Pattern string   `arg:"" name:"pattern" help:"Regex pattern to use in search" type:"string"`
-	Paths   []string `arg:"" optional:"" name:"path" help:"Paths to search" type:"path"`
+	Pattern  string   `arg:"" optional:"" name:"pattern" help:"Regex pattern to use in search, if no -e is given" type:"string"`
+	Paths    []string `arg:"" optional:"" name:"path" help:"Paths to search, - reads from standard input" type:"path"`
+	Regexps  []string `short:"e" name:"regexp" help:"Pattern to use in search, can be given multiple times to search for lines matching any of them"`
+	MaxCount int      `short:"m" name:"max-count" help:"Stop searching a file after this many matching lines, 0 means no limit" default:"0"`
 }
 
 func main() {
@@ -36,7 +43,18 @@ func main() {
 		kong.UsageOnError(),
 	)
 
-	re, err := regex.Compile(cli.Pattern)
+	patterns := cli.Regexps
+	if len(patterns) == 0 {
+		if cli.Pattern == "" {
+			log.Fatalf("no pattern given")
+		}
+		patterns = []string{cli.Pattern}
+	} else if cli.Pattern != "" {
+		// with -e, all positional arguments are paths
+		cli.Paths = append([]string{cli.Pattern}, cli.Paths...)
+	}
+
+	set, err := regex.CompileSet(patterns)
 	if err != nil {
 		log.Fatalf("failed to build regex: %v", err)
 	}
@@ -46,15 +64,22 @@ func main() {
 	}
 
 	for _, path := range cli.Paths {
+		if path == "-" {
+			if err := search("(standard input)", os.Stdin, &set); err != nil {
+				log.Fatalf("%v", err)
+			}
+			continue
+		}
+
 		info, err := os.Lstat(path)
 		if err != nil {
 			log.Fatalf("%s: %v", path, err)
 		}
 
 		if info.IsDir() {
-			err = recursivelySearchDir(path, &re)
+			err = recursivelySearchDir(path, &set)
 		} else {
-			err = searchFile(path, &re)
+			err = searchFile(path, &set)
 		}
 
 		if err != nil {
@@ -64,7 +89,7 @@ func main() {
 
 }
 
-func recursivelySearchDir(path string, re *regex.Regex) error {
+func recursivelySearchDir(path string, set *regex.Set) error {
 	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
 		if d.IsDir() {
 			return nil
@@ -106,38 +131,56 @@ func recursivelySearchDir(path string, re *regex.Regex) error {
 			return nil
 		}
 
-		return searchFile(path, re)
+		return searchFile(path, set)
 	})
 
 	return err
 }
 
-func searchFile(path string, re *regex.Regex) error {
-	content, err := os.ReadFile(path)
+func searchFile(path string, set *regex.Set) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	return search(path, f, set)
+}
 
+// search prints all lines read from r that contain a match, the input is read line by line so that
+// huge files and pipes don't have to fit into memory
+func search(name string, r io.Reader, set *regex.Set) error {
+	br := bufio.NewReader(r)
 	printFileHeader := false
-	for i, line := range strings.Split(string(content), "\n") {
-		matches := re.FindAllSubmatches(line, -1)
-		if len(matches) == 0 {
-			continue
+	matchingLines := 0
+	for i := 0; cli.MaxCount == 0 || matchingLines < cli.MaxCount; i++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", name, err)
 		}
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
 
-		if !printFileHeader {
-			printFileHeader = true
-			fmt.Println(path, ":")
+		matches := findMatches(set, line)
+		if len(matches) == 0 {
+			continue
 		}
 
 		out := strings.Builder{}
 		lastMatchEnd := 0
 		for _, match := range matches {
-			out.WriteString(line[lastMatchEnd:match[0].Offset])
-			out.WriteString(formatMatch(match))
-			lastMatchEnd = match[0].Offset + len(match[0].Str)
+			out.Write(line[lastMatchEnd:match[0]])
+			out.WriteString(formatMatch(line, match))
+			lastMatchEnd = match[1]
+		}
+		out.Write(line[lastMatchEnd:])
+		matchingLines++
+
+		if !printFileHeader {
+			printFileHeader = true
+			fmt.Println(name, ":")
 		}
-		out.WriteString(line[lastMatchEnd:])
 		fmt.Printf("%d:%s\n", i+1, out.String())
 	}
 
@@ -148,20 +191,69 @@ func searchFile(path string, re *regex.Regex) error {
 	return nil
 }
 
-func formatMatch(match []regex.Submatch) string {
-	fullMatch := match[0].Str
-	if len(match) == 1 || len(match) > len(submatchColors) {
-		return submatchColors[0].Sprint(fullMatch)
+// findMatches returns the matches of all patterns in line, ordered by their position.
+// where matches of different patterns overlap, the one starting first (or the longer one) is kept
+func findMatches(set *regex.Set, line []byte) [][]int {
+	// a single pattern doesn't need a separate pass to find out whether it matches
+	patterns := []int{0}
+	if set.Len() > 1 {
+		patterns = set.MatchesBytes(line)
+	}
+
+	var matches [][]int
+	for _, i := range patterns {
+		for match := range set.Regex(i).AllIndexBytes(line) {
+			matches = append(matches, match)
+		}
+	}
+	if len(patterns) < 2 {
+		return matches
+	}
+
+	slices.SortStableFunc(matches, func(a, b []int) int {
+		return cmp.Or(a[0]-b[0], b[1]-a[1])
+	})
+	kept := matches[:0]
+	for _, match := range matches {
+		if len(kept) > 0 {
+			last := kept[len(kept)-1]
+			if match[0] < last[1] || match[0] == last[0] {
+				continue
+			}
+		}
+		kept = append(kept, match)
+	}
+	return kept
+}
+
+// formatMatch colours every part of the match in the colour of the innermost group containing it.
+// groups that did not take part in the match are skipped, colours are reused if there are more groups than colours
+func formatMatch(line []byte, match []int) string {
+	groupColor := func(group int) *color.Color {
+		if group == 0 {
+			return submatchColors[0]
+		}
+		return submatchColors[(group-1)%(len(submatchColors)-1)+1]
+	}
+
+	// the group with the highest index containing a position is the innermost one,
+	// as nested groups are numbered after the groups containing them
+	innermostGroup := func(pos int) int {
+		for g := len(match)/2 - 1; g > 0; g-- {
+			if match[2*g] >= 0 && match[2*g] <= pos && pos < match[2*g+1] {
+				return g
+			}
+		}
+		return 0
 	}
 
 	out := strings.Builder{}
-	matchOff := 0
-	for i, sm := range match[1:] {
-		offRelativeToMatch := sm.Offset - match[0].Offset
-		submatchColors[0].Fprint(&out, fullMatch[matchOff:offRelativeToMatch])
-		submatchColors[i+1].Fprint(&out, sm.Str)
-		matchOff = offRelativeToMatch + len(sm.Str)
+	segmentStart := match[0]
+	for pos := match[0]; pos < match[1]; pos++ {
+		if pos+1 == match[1] || innermostGroup(pos+1) != innermostGroup(segmentStart) {
+			groupColor(innermostGroup(segmentStart)).Fprint(&out, string(line[segmentStart:pos+1]))
+			segmentStart = pos + 1
+		}
 	}
-	submatchColors[0].Fprint(&out, fullMatch[matchOff:])
 	return out.String()
 }
@@ -0,0 +1,93 @@
+package regex
+
+// ahoCorasick finds the occurrences of any of a set of literals in a single pass over the text.
+// it is built as a DFA over byte classes, so every byte of the text costs a single table lookup.
+// bytes that don't occur in any literal share class 0
+type ahoCorasick struct {
+	classes    [256]int32
+	numClasses int
+	// trans[s*numClasses+c] is the state after reading a byte of class c in state s, state 0 is the root
+	trans []int32
+	// length of the literal prefix spelled by each state
+	depth []int32
+	// a literal ends in the state, or in one of the suffixes of its prefix
+	out []bool
+}
+
+func newAhoCorasick(lits []string) *ahoCorasick {
+	ac := &ahoCorasick{numClasses: 1}
+	for _, lit := range lits {
+		for i := 0; i < len(lit); i++ {
+			if ac.classes[lit[i]] == 0 {
+				ac.classes[lit[i]] = int32(ac.numClasses)
+				ac.numClasses++
+			}
+		}
+	}
+
+	// build the trie, missing transitions are -1
+	ac.addState(0)
+	for _, lit := range lits {
+		s := int32(0)
+		for i := 0; i < len(lit); i++ {
+			t := int(s)*ac.numClasses + int(ac.classes[lit[i]])
+			if ac.trans[t] == -1 {
+				// addState grows trans, so the index has to be resolved again afterwards
+				next := ac.addState(ac.depth[s] + 1)
+				ac.trans[t] = next
+			}
+			s = ac.trans[t]
+		}
+		ac.out[s] = true
+	}
+
+	// fill in the missing transitions with those of the longest proper suffix that is in the trie,
+	// breadth first so that the suffixes are always complete
+	fail := make([]int32, len(ac.depth))
+	queue := []int32{0}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for c := range ac.numClasses {
+			t := &ac.trans[int(s)*ac.numClasses+c]
+			switch {
+			case *t != -1 && s == 0:
+				fail[*t] = 0
+				queue = append(queue, *t)
+			case *t != -1:
+				fail[*t] = ac.trans[int(fail[s])*ac.numClasses+c]
+				ac.out[*t] = ac.out[*t] || ac.out[fail[*t]]
+				queue = append(queue, *t)
+			case s == 0:
+				*t = 0
+			default:
+				*t = ac.trans[int(fail[s])*ac.numClasses+c]
+			}
+		}
+	}
+	return ac
+}
+
+func (ac *ahoCorasick) addState(depth int32) int32 {
+	for range ac.numClasses {
+		ac.trans = append(ac.trans, -1)
+	}
+	ac.depth = append(ac.depth, depth)
+	ac.out = append(ac.out, false)
+	return int32(len(ac.depth) - 1)
+}
+
+// acIndex returns a position at or after pos, and at or before the leftmost start of an occurrence of one of
+// the literals in text, or -1 if there is none
+func acIndex[T string | []byte](ac *ahoCorasick, text T, pos int) int {
+	s := int32(0)
+	for i := pos; i < len(text); i++ {
+		s = ac.trans[int(s)*ac.numClasses+int(ac.classes[text[i]])]
+		if ac.out[s] {
+			// s spells the longest suffix of the text that can still become an occurrence, an occurrence
+			// starting before it would have ended earlier. so no occurrence starts before this position
+			return i + 1 - int(ac.depth[s])
+		}
+	}
+	return -1
+}
@@ -0,0 +1,238 @@
+package regex
+
+import (
+	"unicode"
+)
+
+// the backtracker executes a prog by following one path at a time and undoing it when it fails.
+// it is used for programs with backreferences, as the captures of the current path are always known.
+// the stack of jobs is kept explicitly, so that deep paths don't grow the goroutine stack.
+//
+// without backreferences, whether a path fails only depends on the instruction and the position. the backtracker
+// then remembers the visited pairs in a bitset and never tries one twice, which bounds the run time to
+// the size of the program times the length of the input. this is what the pike VM does as well, so both give
+// the same matches. the bitset is only used for short inputs, longer ones are handed to the pike VM.
+// with backreferences the run time is exponential in the worst case
+
+// maximum size of the visited bitset of the backtracker in bits
+const maxVisitedBits = 256 * 1024
+
+type jobKind uint8
+
+const (
+	// continue at pc and pos
+	jobBranch jobKind = iota
+	// restore capture slot pc to the value pos
+	jobRestoreCap
+	// restore the position of loop pc to the value pos
+	jobRestoreLoop
+)
+
+type job struct {
+	kind jobKind
+	pc   int
+	pos  int
+}
+
+// canMemoise reports whether the visited bitset for in fits into maxVisitedBits,
+// so that the backtracker can be used instead of the pike VM
+func (m *machine) canMemoise(in literalInput) bool {
+	return !m.p.backrefs && len(m.p.insts) <= maxVisitedBits/(in.length()+1)
+}
+
+// backtrack searches in for the leftmost match starting at or after the byte offset pos.
+// on success, the capture slots of the match are stored in m.matchcap.
+// programs without backreferences can only be run on inputs for which canMemoise is true
+func (m *machine) backtrack(in input, pos int) bool {
+	m.matched = false
+	for i := range m.matchcap {
+		m.matchcap[i] = -1
+	}
+	if len(m.loops) != m.p.numLoops {
+		m.loops = make([]int, m.p.numLoops)
+	}
+
+	lit, _ := in.(literalInput)
+	m.visitedStride = 0
+	if !m.p.backrefs {
+		// the visited pairs stay valid for all start positions, the paths from them failed no matter where they started
+		m.visitedStride = lit.length() + 1
+		n := (len(m.p.insts)*m.visitedStride + 31) / 32
+		if cap(m.visited) < n {
+			m.visited = make([]uint32, n)
+		}
+		m.visited = m.visited[:n]
+		clear(m.visited)
+		if !m.checkMemory() {
+			return false
+		}
+	}
+	for {
+		if lit != nil {
+			// skip ahead to where a match can start
+			if pos = m.p.pre.next(in, lit, pos); pos < 0 {
+				return false
+			}
+		}
+		if m.tryBacktrack(in, pos) {
+			return true
+		}
+		if m.err != nil {
+			return false
+		}
+		_, w := in.step(pos)
+		if w == 0 {
+			return false
+		}
+		pos += w
+	}
+}
+
+// tryBacktrack looks for a match starting exactly at pos
+func (m *machine) tryBacktrack(in input, pos int) bool {
+	caps := m.caps
+	for i := range caps {
+		caps[i] = -1
+	}
+	for i := range m.loops {
+		m.loops[i] = -1
+	}
+
+	m.jobs = m.jobs[:0]
+	m.push(job{kind: jobBranch, pc: m.p.start, pos: pos})
+	for len(m.jobs) > 0 {
+		j := m.jobs[len(m.jobs)-1]
+		m.jobs = m.jobs[:len(m.jobs)-1]
+
+		switch j.kind {
+		case jobRestoreCap:
+			caps[j.pc] = j.pos
+			continue
+		case jobRestoreLoop:
+			m.loops[j.pc] = j.pos
+			continue
+		}
+
+		pc, pos := j.pc, j.pos
+	path:
+		for {
+			if !m.charge(1) {
+				return false
+			}
+			if m.visitedStride > 0 && !m.visit(pc, pos) {
+				break path
+			}
+			i := &m.p.insts[pc]
+			switch i.op {
+			case instFail:
+				break path
+			case instNop:
+				pc = i.out
+			case instAlt:
+				// try the preferred branch first, the other one once we come back
+				m.push(job{kind: jobBranch, pc: i.arg, pos: pos})
+				pc = i.out
+			case instSave:
+				m.push(job{kind: jobRestoreCap, pc: i.arg, pos: caps[i.arg]})
+				caps[i.arg] = pos
+				pc = i.out
+			case instProgress:
+				if m.visitedStride > 0 {
+					// an empty iteration comes back to an instruction and position that were visited already
+					pc = i.out
+					continue
+				}
+				if m.loops[i.arg] == pos {
+					break path
+				}
+				m.push(job{kind: jobRestoreLoop, pc: i.arg, pos: m.loops[i.arg]})
+				m.loops[i.arg] = pos
+				pc = i.out
+			case instLook:
+				if !m.p.looks[i.arg].matches(in, pos, &m.looks) {
+					break path
+				}
+				pc = i.out
+			case instEmpty:
+				before, _ := in.before(pos)
+				after, _ := in.step(pos)
+				if emptyOp(i.arg)&^emptyOpContext(before, after) != 0 {
+					break path
+				}
+				pc = i.out
+			case instChar, instBracket:
+				c, w := in.step(pos)
+				if w == 0 || !i.matches(c) {
+					break path
+				}
+				pos += w
+				pc = i.out
+			case instBackref:
+				from, to := caps[2*i.arg], caps[2*i.arg+1]
+				if from < 0 || to < 0 {
+					// a group that did not take part in the match can't be referenced
+					break path
+				}
+				n, ok := matchBackref(in, pos, from, to, i.fold)
+				if !ok {
+					break path
+				}
+				pos += n
+				pc = i.out
+			case instMatch:
+				copy(m.matchcap, caps)
+				m.matched = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// push adds j to the stack of jobs. the stack is the memory of the backtracker that grows with the input,
+// so it is checked against the budget
+func (m *machine) push(j job) {
+	m.jobs = append(m.jobs, j)
+	if m.budget.Memory > 0 {
+		m.checkMemory()
+	}
+}
+
+// visit marks the instruction pc at pos as visited, it returns false if it was visited already
+func (m *machine) visit(pc, pos int) bool {
+	k := pc*m.visitedStride + pos
+	if m.visited[k/32]&(1<<(k%32)) != 0 {
+		return false
+	}
+	m.visited[k/32] |= 1 << (k % 32)
+	return true
+}
+
+// matchBackref checks whether in continues at pos with the text captured between from and to.
+// returns the number of bytes that were matched, which can differ from to-from if fold is set
+func matchBackref(in input, pos, from, to int, fold bool) (int, bool) {
+	j := pos
+	for from < to {
+		want, wantW := in.step(from)
+		c, w := in.step(j)
+		if w == 0 || c != want && !(fold && equalFold(c, want)) {
+			return 0, false
+		}
+		from += wantW
+		j += w
+	}
+	return j - pos, true
+}
+
+// equalFold reports whether a and b are equal under simple unicode case folding
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
+			return true
+		}
+	}
+	return false
+}
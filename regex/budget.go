@@ -0,0 +1,134 @@
+package regex
+
+import (
+	"context"
+	"errors"
+	"math"
+	"unsafe"
+)
+
+// the engines charge every instruction they execute to the budget of the search, including those of look-around
+// assertions. the steps are only compared and the context only checked every few thousand steps, so that the
+// common case costs a single decrement. memory is checked whenever more of it is needed
+
+// ErrBudgetExceeded is returned when a search needs more steps or memory than allowed by the Budget of the Regex
+var ErrBudgetExceeded = errors.New("regex: execution budget exceeded")
+
+// number of steps between two checks of the budget and the context
+const budgetCheckInterval = 4096
+
+// Budget limits the work a single search may do, zero values mean no limit
+type Budget struct {
+	// maximum number of instructions executed by the engines
+	Steps int
+	// maximum number of bytes of working memory, like the threads of the pike VM, the stack of the backtracker
+	// and the states built by the DFA during the search
+	Memory int
+}
+
+// WithBudget returns a copy of re whose searches are limited by b.
+// methods without an error result report no (further) matches once the budget is exhausted, use MatchContext
+// to tell both apart
+func (re Regex) WithBudget(b Budget) Regex {
+	re.budget = b
+	return re
+}
+
+// MatchContext is like Match, but gives up once ctx is done or the budget set with WithBudget is exhausted.
+// it returns the error of ctx or ErrBudgetExceeded then
+func (re Regex) MatchContext(ctx context.Context, s string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m := re.getMachine()
+	defer re.putMachine(m)
+	m.ctx = ctx
+	matched := m.matches(inputString(s), 0)
+	if m.err != nil {
+		return false, m.err
+	}
+	return matched, nil
+}
+
+// startBudget prepares m for a new search limited by b
+func (m *machine) startBudget(b Budget) {
+	// the memory of the backtracker is only in use during a search
+	m.jobs = m.jobs[:0]
+	m.visited = m.visited[:0]
+	// the states cached by earlier searches are not charged to this one, but they are dropped if they alone
+	// take more memory than it may use
+	for _, d := range []*dfa{m.dfa, m.reverseDFA} {
+		if d == nil {
+			continue
+		}
+		if b.Memory > 0 && len(d.states)*int(unsafe.Sizeof(dfaState{})) > b.Memory {
+			d.states = make(map[string]*dfaState)
+		}
+		d.built = 0
+	}
+	m.ctx = nil
+	m.budget = b
+	m.err = nil
+	m.stepsLeft = math.MaxInt
+	if b.Steps > 0 {
+		m.stepsLeft = b.Steps
+	}
+	m.interval = min(budgetCheckInterval, m.stepsLeft)
+	m.untilCheck = m.interval
+}
+
+// charge accounts for n steps of the search. it returns false once the budget is exhausted or the context is done,
+// the engines stop searching then and the reason is stored in m.err
+func (m *machine) charge(n int) bool {
+	m.untilCheck -= n
+	if m.untilCheck >= 0 {
+		return true
+	}
+	return m.checkBudget()
+}
+
+func (m *machine) checkBudget() bool {
+	if m.err != nil {
+		m.untilCheck = 0
+		return false
+	}
+	if m.stepsLeft != math.MaxInt {
+		m.stepsLeft -= m.interval - m.untilCheck
+	}
+	switch {
+	case m.stepsLeft < 0:
+		m.err = ErrBudgetExceeded
+	case m.ctx != nil && m.ctx.Err() != nil:
+		m.err = m.ctx.Err()
+	}
+	if m.err != nil {
+		m.untilCheck = 0
+		return false
+	}
+	m.interval = max(min(budgetCheckInterval, m.stepsLeft), 1)
+	m.untilCheck = m.interval
+	return true
+}
+
+// checkMemory compares the working memory in use against the budget, it is called whenever more of it is needed.
+// it returns false if the budget is exhausted
+func (m *machine) checkMemory() bool {
+	if m.err == nil && m.budget.Memory > 0 && m.memoryUsage() > m.budget.Memory {
+		m.err = ErrBudgetExceeded
+		m.untilCheck = 0
+	}
+	return m.err == nil
+}
+
+// memoryUsage estimates the number of bytes of working memory in use by the current search of m
+func (m *machine) memoryUsage() int {
+	n := len(m.jobs)*int(unsafe.Sizeof(job{})) + len(m.visited)*4
+	n += (m.threads - len(m.pool)) * (int(unsafe.Sizeof(thread{})) + m.p.numCap*8)
+	for _, d := range []*dfa{m.dfa, m.reverseDFA} {
+		if d != nil {
+			// clearing the cache may have dropped some of the states built by this search
+			n += min(d.built, len(d.states)) * int(unsafe.Sizeof(dfaState{}))
+		}
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package regex
+
+import (
+	"slices"
+)
+
+// the []byte variants of the Find methods search b directly, the returned slices point into b
+
+// MatchBytes reports whether b contains a match of the pattern
+func (re Regex) MatchBytes(b []byte) bool {
+	m := re.getMachine()
+	defer re.putMachine(m)
+	return m.matches(inputBytes(b), 0)
+}
+
+// FindBytes returns the leftmost match in b, or nil if there is none
+func (re Regex) FindBytes(b []byte) []byte {
+	loc := re.FindIndexBytes(b)
+	if loc == nil {
+		return nil
+	}
+	return b[loc[0]:loc[1]:loc[1]]
+}
+
+// FindAllBytes returns up to maxCount matches in b, pass -1 to return all of them
+func (re Regex) FindAllBytes(b []byte, maxCount int) [][]byte {
+	var all [][]byte
+	re.allMatches(inputBytes(b), len(b), maxCount, func(caps []int) {
+		all = append(all, b[caps[0]:caps[1]:caps[1]])
+	})
+	return all
+}
+
+// FindIndexBytes returns the start and end offset of the leftmost match in b, or nil if there is none
+func (re Regex) FindIndexBytes(b []byte) []int {
+	all := re.FindAllIndexBytes(b, 1)
+	if len(all) < 1 {
+		return nil
+	}
+	return all[0]
+}
+
+// FindAllIndexBytes returns the start and end offsets of up to maxCount matches in b, pass -1 to return all of them
+func (re Regex) FindAllIndexBytes(b []byte, maxCount int) [][]int {
+	var all [][]int
+	re.allIndexes(inputBytes(b), len(b), maxCount, func(caps []int) {
+		all = append(all, []int{caps[0], caps[1]})
+	})
+	return all
+}
+
+// FindSubmatchBytes returns the leftmost match in b and the text of its groups, or nil if there is none.
+// groups that did not take part in the match are nil
+func (re Regex) FindSubmatchBytes(b []byte) [][]byte {
+	all := re.FindAllSubmatchesBytes(b, 1)
+	if len(all) < 1 {
+		return nil
+	}
+	return all[0]
+}
+
+// FindAllSubmatchesBytes returns up to maxCount matches in b and the text of their groups, pass -1 to return all of them
+func (re Regex) FindAllSubmatchesBytes(b []byte, maxCount int) [][][]byte {
+	var all [][][]byte
+	re.allMatches(inputBytes(b), len(b), maxCount, func(caps []int) {
+		submatches := make([][]byte, len(caps)/2)
+		for i := range submatches {
+			if from, to := caps[2*i], caps[2*i+1]; from >= 0 && to >= 0 {
+				submatches[i] = b[from:to:to]
+			}
+		}
+		all = append(all, submatches)
+	})
+	return all
+}
+
+// FindSubmatchIndexBytes is like FindSubmatchIndex, but searches b
+func (re Regex) FindSubmatchIndexBytes(b []byte) []int {
+	all := re.FindAllSubmatchIndexBytes(b, 1)
+	if len(all) < 1 {
+		return nil
+	}
+	return all[0]
+}
+
+// FindAllSubmatchIndexBytes is like FindAllSubmatchIndex, but searches b
+func (re Regex) FindAllSubmatchIndexBytes(b []byte, maxCount int) [][]int {
+	var all [][]int
+	re.allMatches(inputBytes(b), len(b), maxCount, func(caps []int) {
+		all = append(all, slices.Clone(caps))
+	})
+	return all
+}
@@ -0,0 +1,316 @@
+package regex
+
+import (
+	"encoding/binary"
+)
+
+// the lazy DFA runs a prog without captures by treating the set of pike VM threads as a single state.
+// states are built the first time they are reached and cached together with their transitions, so that
+// most runes of the input only cost a table lookup. the threads of a state are kept in priority order and
+// cut off after a match like in the pike VM, which gives the same leftmost-first match ends.
+// the cache is bounded, when it is full it is cleared. if that happens too often the search gives up
+// and the caller falls back to the pike VM. programs with backreferences or look-around can't be run by the DFA.
+//
+// the forward DFA only finds where the leftmost match ends. its start is found by a reverse DFA, which runs the
+// program compiled from the reversed pattern backwards from the end. it is anchored at the end and looks for
+// the longest match, which ends at the leftmost position a match can start at
+
+const (
+	// maximum number of cached states, each of them takes about 1KB
+	dfaMaxStates = 2048
+	// number of times the cache may be cleared during one search before giving up
+	dfaMaxResets = 8
+)
+
+type dfaState struct {
+	// the instructions waiting at the current position, in priority order. their empty transitions are only
+	// followed on the next step, as zero-width assertions depend on the rune after the position
+	pcs []int
+	// stands in for the rune consumed last, see contextRune. that's the rune before the current position,
+	// or the one after it for a reverse DFA
+	prev rune
+	// a match was found, so no new threads are started
+	matched bool
+	// a match was found at the position the last rune was consumed from
+	matchBefore bool
+
+	// cached transitions for ASCII runes, all other runes and the end of the input
+	ascii [128]*dfaState
+	other map[rune]*dfaState
+	end   *dfaState
+}
+
+type dfa struct {
+	p *prog
+	// the machine the DFA belongs to, which keeps track of the budget
+	m *machine
+	// run backwards, see searchReverse
+	reverse bool
+	states  map[string]*dfaState
+	resets  int
+	// number of states built since the start of the current search, only those are charged to its budget
+	built int
+	// scratch space for computing transitions
+	seen   queue
+	list   []int
+	next   []int
+	keyBuf []byte
+}
+
+func newDFA(p *prog, reverse bool, m *machine) *dfa {
+	return &dfa{
+		p:       p,
+		m:       m,
+		reverse: reverse,
+		states:  make(map[string]*dfaState),
+		seen:    newQueue(len(p.insts)),
+	}
+}
+
+// contextRune maps c to a rune that satisfies the same zero-width assertions, so that states only differ in
+// the previous rune if it matters
+func contextRune(c rune) rune {
+	switch {
+	case c < 0:
+		return -1
+	case c == '\n':
+		return '\n'
+	case isWordChar(c):
+		return 'a'
+	}
+	return ' '
+}
+
+// search looks for the leftmost match starting at or after pos and returns its end, or -1 if there is none.
+// if first is set, it returns the end of the first match it finds instead, which is enough to know that there is one.
+// ok is false if the cache had to be cleared too often, the search has to be repeated with the pike VM then.
+// it is also false if the budget of the machine is exhausted
+func (d *dfa) search(in input, lit literalInput, pos int, first bool) (end int, ok bool) {
+	d.resets = 0
+	if !d.m.checkMemory() {
+		return -1, false
+	}
+	before, _ := in.before(pos)
+	s := d.state(nil, contextRune(before), false, false)
+	if s == nil {
+		return -1, false
+	}
+
+	end = -1
+	for {
+		if lit != nil && len(s.pcs) == 0 && !s.matched {
+			// no thread is running, skip ahead to where a match can start
+			next := d.p.pre.next(in, lit, pos)
+			if next < 0 {
+				return end, true
+			}
+			if next > pos {
+				pos = next
+				before, _ := in.before(pos)
+				if s = d.state(nil, contextRune(before), false, false); s == nil {
+					return -1, false
+				}
+			}
+		}
+
+		if !d.m.charge(1) {
+			return -1, false
+		}
+		c, w := in.step(pos)
+		if s = d.transition(s, c); s == nil {
+			return -1, false
+		}
+		if s.matchBefore {
+			end = pos
+			if first {
+				return end, true
+			}
+		}
+		if w == 0 || s.matched && len(s.pcs) == 0 {
+			return end, true
+		}
+		pos += w
+	}
+}
+
+// searchReverse runs a reverse DFA backwards from end and returns the leftmost position at or after limit
+// at which a match ending at end starts, or -1 if there is none. ok is false like for search
+func (d *dfa) searchReverse(in input, end, limit int) (start int, ok bool) {
+	d.resets = 0
+	if !d.m.checkMemory() {
+		return -1, false
+	}
+	after, _ := in.step(end)
+	s := d.state([]int{d.p.start}, contextRune(after), false, false)
+	if s == nil {
+		return -1, false
+	}
+
+	start = -1
+	for pos := end; ; {
+		if !d.m.charge(1) {
+			return -1, false
+		}
+		c, w := in.before(pos)
+		if s = d.transition(s, c); s == nil {
+			return -1, false
+		}
+		if s.matchBefore {
+			start = pos
+		}
+		if w == 0 || pos <= limit || len(s.pcs) == 0 {
+			return start, true
+		}
+		pos -= w
+	}
+}
+
+// transition returns the state after consuming c in s, or the state at the end of the input if c is -1.
+// a reverse DFA consumes the rune before the current position instead of the one after it.
+// it returns nil if the cache had to be cleared too often
+func (d *dfa) transition(s *dfaState, c rune) *dfaState {
+	var t *dfaState
+	switch {
+	case c < 0:
+		t = s.end
+	case c < 128:
+		t = s.ascii[c]
+	default:
+		t = s.other[c]
+	}
+	if t != nil {
+		return t
+	}
+
+	if len(d.states) >= dfaMaxStates {
+		// start over with an empty cache, s has to be rebuilt as it points into the old one
+		d.resets++
+		if d.resets > dfaMaxResets {
+			return nil
+		}
+		d.states = make(map[string]*dfaState)
+		s = d.state(s.pcs, s.prev, s.matched, s.matchBefore)
+	}
+
+	// follow the empty transitions, now that the rune on the other side of the position is known
+	ctx := emptyOpContext(s.prev, c)
+	if d.reverse {
+		ctx = emptyOpContext(c, s.prev)
+	}
+	d.seen.clear()
+	d.list = d.list[:0]
+	matchHere := false
+	for _, pc := range s.pcs {
+		if d.closure(pc, ctx) {
+			matchHere = true
+			if !d.reverse {
+				break
+			}
+		}
+	}
+	// a reverse DFA is anchored at the end of the match, so it never starts new threads
+	if !matchHere && !s.matched && !d.reverse {
+		// new threads have the lowest priority
+		matchHere = d.closure(d.p.start, ctx)
+	}
+
+	d.next = d.next[:0]
+	if c >= 0 {
+		d.seen.clear()
+		for _, pc := range d.list {
+			i := &d.p.insts[pc]
+			if i.matches(c) && !d.seen.contains(i.out) {
+				d.seen.add(i.out)
+				d.next = append(d.next, i.out)
+			}
+		}
+	}
+	if t = d.state(d.next, contextRune(c), s.matched || matchHere, matchHere); t == nil {
+		return nil
+	}
+
+	switch {
+	case c < 0:
+		s.end = t
+	case c < 128:
+		s.ascii[c] = t
+	default:
+		if s.other == nil {
+			s.other = make(map[rune]*dfaState)
+		}
+		s.other[c] = t
+	}
+	return t
+}
+
+// closure follows the empty transitions from pc and appends the instructions consuming a rune to d.list.
+// it returns true as soon as it reaches a match, all threads after it have a lower priority and are cut off.
+// a reverse DFA looks for the longest match, so it keeps all threads and only reports whether there was a match
+func (d *dfa) closure(pc int, ctx emptyOp) bool {
+	if d.seen.contains(pc) {
+		return false
+	}
+	d.seen.add(pc)
+
+	i := &d.p.insts[pc]
+	switch i.op {
+	case instNop, instSave, instProgress:
+		return d.closure(i.out, ctx)
+	case instAlt:
+		if d.reverse {
+			matched := d.closure(i.out, ctx)
+			return d.closure(i.arg, ctx) || matched
+		}
+		return d.closure(i.out, ctx) || d.closure(i.arg, ctx)
+	case instEmpty:
+		if emptyOp(i.arg)&^ctx == 0 {
+			return d.closure(i.out, ctx)
+		}
+	case instChar, instBracket:
+		d.list = append(d.list, pc)
+	case instMatch:
+		return true
+	}
+	return false
+}
+
+// state returns the cached state for the given threads and flags, creating it if needed.
+// it returns nil if the cache is full and has been cleared too often, or if the memory budget is exhausted
+func (d *dfa) state(pcs []int, prev rune, matched, matchBefore bool) *dfaState {
+	d.keyBuf = d.keyBuf[:0]
+	d.keyBuf = binary.AppendVarint(d.keyBuf, int64(prev))
+	var flags byte
+	if matched {
+		flags |= 1
+	}
+	if matchBefore {
+		flags |= 2
+	}
+	d.keyBuf = append(d.keyBuf, flags)
+	for _, pc := range pcs {
+		d.keyBuf = binary.AppendUvarint(d.keyBuf, uint64(pc))
+	}
+	if s, ok := d.states[string(d.keyBuf)]; ok {
+		return s
+	}
+
+	if len(d.states) >= dfaMaxStates {
+		d.resets++
+		if d.resets > dfaMaxResets {
+			return nil
+		}
+		d.states = make(map[string]*dfaState)
+	}
+	s := &dfaState{
+		pcs:         append([]int(nil), pcs...),
+		prev:        prev,
+		matched:     matched,
+		matchBefore: matchBefore,
+	}
+	d.states[string(d.keyBuf)] = s
+	d.built++
+	if !d.m.checkMemory() {
+		return nil
+	}
+	return s
+}
@@ -1,11 +1,11 @@
 package regex
 
 import (
-	"slices"
+	"context"
 )
 
 type charState struct {
-	char byte
+	char rune
 }
 
 type bracketState struct {
@@ -19,143 +19,391 @@ type choiceState struct {
 
 type groupState struct {
 	firstChild *node
-	match      *Submatch
+	// false for (?:...) and (?flags:...) groups
+	capture bool
+	// set for (?P<name>...) and (?<name>...) groups
+	name string
+	// capture index, assigned after parsing
+	index int
 }
 
+// \1 to \9 and \k<name>, matches the text last captured by the referenced group
+type backrefState struct {
+	// set for \k<name>, index is resolved after parsing
+	name  string
+	index int
+}
+
+// (?=...), (?!...), (?<=...) and (?<!...), matches the empty string if firstChild matches after (or before) it
+type lookState struct {
+	firstChild *node
+	behind     bool
+	negate     bool
+	// bounds of the number of runes matched by a lookbehind
+	minLen int
+	maxLen int
+}
+
+// ^, $, \A, \z, \b and \B, matches the empty string if the surrounding runes satisfy op
+type assertState struct {
+	op emptyOp
+}
+
+// (?flags) matches the empty string, the new flags are stored in the node
+type flagState struct{}
+
+// flags change how nodes are matched, they are set by (?flags) and (?flags:...)
+type flags uint8
+
+const (
+	// i: case-insensitive
+	flagFoldCase flags = 1 << iota
+	// m: ^ and $ match at the beginning and end of lines
+	flagMultiLine
+	// s: . also matches '\n'
+	flagDotNL
+	// U: quantifiers are lazy by default
+	flagUngreedy
+)
+
 type node struct {
 	state any
 	mi    int
 	ma    int
+	// the quantifier prefers fewer repetitions, inverted by flagUngreedy
+	lazy  bool
+	flags flags
 	next  *node
 	str   string
 }
 
-func (n *node) match(in string, i, r int) (int, bool) {
-	if n != nil {
-		//fmt.Fprintf(os.Stdout, "%s, %s, %d, %d\n", in, n.str, i, r)
+// the pike VM executes a prog on all possible paths through the program in lockstep.
+// each thread carries its own capture slots, so the captures of a group are correct for any path
+// that reaches the match, and the run time is linear in the length of the input.
+// threads are kept in priority order, which gives the same leftmost-first semantics as backtracking
+
+type thread struct {
+	caps []int
+}
+
+type entry struct {
+	pc int
+	t  *thread
+}
+
+// queue is a sparse set of instructions, preserving insertion order
+type queue struct {
+	sparse []int
+	dense  []entry
+}
+
+func newQueue(n int) queue {
+	return queue{sparse: make([]int, n), dense: make([]entry, 0, n)}
+}
+
+func (q *queue) contains(pc int) bool {
+	j := q.sparse[pc]
+	return j < len(q.dense) && q.dense[j].pc == pc
+}
+
+func (q *queue) add(pc int) int {
+	j := len(q.dense)
+	q.dense = append(q.dense, entry{pc: pc})
+	q.sparse[pc] = j
+	return j
+}
+
+func (q *queue) clear() {
+	q.dense = q.dense[:0]
+}
+
+// machine holds all mutable state of a search, so it must only be used by one goroutine at a time
+type machine struct {
+	p        *prog
+	q0, q1   queue
+	pool     []*thread
+	matched  bool
+	matchcap []int
+	// scratch capture slots for starting new threads
+	caps []int
+	// the input of the current search, needed by look-around assertions
+	in input
+	// earliest start of a match that was still possible before the last rune of the input, set by the pike VM.
+	// used to resume a search once more input is available
+	pending int
+	// state of the backtracker, see backtrack.go
+	jobs []job
+	// positions at which each loop last started an iteration
+	loops []int
+	// the instructions and positions visited by the backtracker, visitedStride is 0 if they aren't tracked
+	visited       []uint32
+	visitedStride int
+	// queues for running the look-around assertions, see lookaround.go
+	looks lookScratch
+	// the lazy DFAs, nil if the program can't be run by them. see dfa.go
+	dfa, reverseDFA *dfa
+	// number of threads allocated by the pike VM
+	threads int
+	// the budget of the current search and how much of it is left, see budget.go
+	ctx        context.Context
+	budget     Budget
+	stepsLeft  int
+	interval   int
+	untilCheck int
+	// why the current search stopped early, if it did
+	err error
+}
+
+func newMachine(p *prog) *machine {
+	m := &machine{
+		p:        p,
+		q0:       newQueue(len(p.insts)),
+		q1:       newQueue(len(p.insts)),
+		matchcap: make([]int, p.numCap),
+		caps:     make([]int, p.numCap),
 	}
+	if p.reversed != nil {
+		m.dfa = newDFA(p, false, m)
+		m.reverseDFA = newDFA(p.reversed, true, m)
+	}
+	m.looks.budget = m
+	m.startBudget(Budget{})
+	return m
+}
 
-	if n == nil {
-		return i, true
+func (m *machine) alloc() *thread {
+	if m.budget.Memory > 0 {
+		m.checkMemory()
 	}
+	if n := len(m.pool); n > 0 {
+		t := m.pool[n-1]
+		m.pool = m.pool[:n-1]
+		return t
+	}
+	m.threads++
+	return &thread{caps: make([]int, m.p.numCap)}
+}
 
-	j := i
-	matchFound := false
-	switch s := n.state.(type) {
-	case *charState:
-		if i >= len(in) {
-			if r < n.mi {
-				return i, false
-			}
-			return n.next.match(in, i, 0)
+func (m *machine) free(t *thread) {
+	m.pool = append(m.pool, t)
+}
+
+func (m *machine) clear(q *queue) {
+	for _, e := range q.dense {
+		if e.t != nil {
+			m.free(e.t)
 		}
+	}
+	q.clear()
+}
 
-		if in[i] == s.char {
-			j++
-			matchFound = true
+// match searches in for the leftmost match starting at or after the byte offset pos.
+// on success, the capture slots of the match are stored in m.matchcap
+func (m *machine) match(in input, pos int) bool {
+	lit, isLit := in.(literalInput)
+	if isLit && !m.p.pre.possible(lit, pos) {
+		m.matched = false
+		return false
+	}
+	if m.p.onePass != nil {
+		return m.onePass(in, pos)
+	}
+	// the DFA only needs the input to be random access, so that the pike VM can run after it
+	if isLit && m.dfa != nil {
+		if end, ok := m.dfa.search(in, lit, pos, false); ok && end < 0 {
+			m.matched = false
+			return false
 		}
-	case *bracketState:
-		if i >= len(in) {
-			if r < n.mi {
-				return i, false
-			}
-			return n.next.match(in, i, 0)
+	}
+	// backreferences depend on the captures of a single path, which the pike VM can't provide
+	if m.p.backrefs || isLit && m.canMemoise(lit) {
+		return m.backtrack(in, pos)
+	}
+	return m.pike(in, pos)
+}
+
+// matches reports whether there is a match starting at or after the byte offset pos, without computing its
+// position if the DFA can answer that. m.matchcap is only set if the pike VM or backtracker had to run
+func (m *machine) matches(in input, pos int) bool {
+	if lit, ok := in.(literalInput); ok && m.dfa != nil {
+		if !m.p.pre.possible(lit, pos) {
+			return false
+		}
+		if end, ok := m.dfa.search(in, lit, pos, true); ok {
+			return end >= 0
 		}
+	}
+	return m.match(in, pos)
+}
+
+// matchIndex is like match, but only sets the start and end of the match in m.matchcap if the DFAs can find them.
+// the capture slots of the groups are unspecified then
+func (m *machine) matchIndex(in input, pos int) bool {
+	lit, ok := in.(literalInput)
+	if !ok || m.dfa == nil {
+		return m.match(in, pos)
+	}
+	if !m.p.pre.possible(lit, pos) {
+		m.matched = false
+		return false
+	}
+	end, ok := m.dfa.search(in, lit, pos, false)
+	if !ok {
+		return m.match(in, pos)
+	}
+	if end < 0 {
+		m.matched = false
+		return false
+	}
+	start, ok := m.reverseDFA.searchReverse(in, end, pos)
+	if !ok || start < 0 {
+		// start < 0 can't happen, but the pike VM gives the right answer either way
+		return m.match(in, pos)
+	}
+	m.matched = true
+	m.matchcap[0], m.matchcap[1] = start, end
+	return true
+}
+
+func (m *machine) pike(in input, pos int) bool {
+	m.in = in
+	defer func() { m.in = nil }()
+	m.matched = false
+	for i := range m.matchcap {
+		m.matchcap[i] = -1
+	}
+	m.pending = pos
 
-		if slices.ContainsFunc(s.ranges, func(r charRange) bool { return r.inRange(in[i]) }) {
-			if !s.negate {
-				matchFound = true
-				j++
+	lit, _ := in.(literalInput)
+	runq, nextq := &m.q0, &m.q1
+	caps := m.caps
+	c, w := in.step(pos)
+	for {
+		if lit != nil && !m.matched && len(runq.dense) == 0 {
+			// no thread is running, skip ahead to where a match can start
+			next := m.p.pre.next(in, lit, pos)
+			if next < 0 {
+				break
 			}
-		} else if s.negate {
-			matchFound = true
-			j++
-		}
-	case *choiceState:
-		for _, c := range s.choices {
-			j, matchFound := c.match(in, i, 0)
-			if matchFound {
-				return j, matchFound
+			if next > pos {
+				pos = next
+				c, w = in.step(pos)
 			}
 		}
-		return i, false
-	case *groupState:
-		j, matchFound = s.firstChild.match(in, i, 0)
-	default:
-		panic("unexpected `state` type")
-	}
-
-	if matchFound {
-		// repeat current expression (greedy)
-		if r+1 < n.ma {
-			end, match := n.match(in, j, r+1)
-			if match {
-				if g, ok := n.state.(*groupState); ok && g.match == nil {
-					g.match = &Submatch{
-						Offset: i,
-						Str:    in[i:j],
-					}
-				}
-				return end, match
+
+		// only start new threads until we found a match, as those would have lower priority
+		if !m.matched {
+			for i := range caps {
+				caps[i] = -1
 			}
+			before, _ := in.before(pos)
+			m.add(runq, m.p.start, pos, caps, emptyOpContext(before, c))
+		}
+		if len(runq.dense) == 0 {
+			break
 		}
 
-		// advance to next expression
-		if r+1 >= n.mi {
-			end, match := n.next.match(in, j, 0)
-			if match {
-				if g, ok := n.state.(*groupState); ok && g.match == nil {
-					g.match = &Submatch{
-						Offset: i,
-						Str:    in[i:j],
-					}
+		next, nextW := in.step(pos + w)
+		if w > 0 && nextW == 0 {
+			m.pending = pos
+			for _, e := range runq.dense {
+				if e.t != nil {
+					m.pending = min(m.pending, e.t.caps[0])
 				}
-				return end, match
 			}
 		}
+		m.step(runq, nextq, pos, pos+w, c, emptyOpContext(c, next))
+		if w == 0 || m.err != nil {
+			break
+		}
+		pos += w
+		c, w = next, nextW
+		runq, nextq = nextq, runq
+	}
+	m.clear(nextq)
+	if m.err != nil {
+		// the search stopped early, a match found so far might not be the leftmost-first one
+		m.matched = false
 	}
+	return m.matched
+}
+
+// step advances all threads in runq over the rune c at pos into nextq.
+// nextPos is the position after c and ctx is the zero-width context at nextPos
+func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, ctx emptyOp) {
+	for j := 0; j < len(runq.dense); j++ {
+		e := &runq.dense[j]
+		t := e.t
+		if t == nil {
+			continue
+		}
 
-	// for ? and *, also jump to next expression once without consuming the current match
-	if n.mi == 0 && r == 0 {
-		end, match := n.next.match(in, i, 0)
-		if g, ok := n.state.(*groupState); ok && g.match == nil {
-			g.match = &Submatch{
-				Offset: i,
-				Str:    "",
+		i := &m.p.insts[e.pc]
+		switch i.op {
+		case instMatch:
+			t.caps[1] = pos
+			copy(m.matchcap, t.caps)
+			m.matched = true
+			// cut off all lower priority threads
+			for _, d := range runq.dense[j:] {
+				if d.t != nil {
+					m.free(d.t)
+				}
+			}
+			runq.clear()
+			return
+		case instChar, instBracket:
+			if c >= 0 && i.matches(c) {
+				m.add(nextq, i.out, nextPos, t.caps, ctx)
 			}
 		}
-		return end, match
+		m.free(t)
 	}
-
-	return i, false
+	runq.clear()
 }
 
-func (n *node) collectSubmatches(in string, submatches *[]Submatch) {
-	if n == nil {
+// add follows all empty transitions from pc and adds the resulting threads to q in priority order
+func (m *machine) add(q *queue, pc, pos int, caps []int, ctx emptyOp) {
+	if q.contains(pc) || !m.charge(1) {
 		return
 	}
 
-	switch s := n.state.(type) {
-	case *groupState:
-		if s.match != nil {
-			*submatches = append(*submatches, *s.match)
-			// reset state so that we can reuse regex
-			s.match = nil
+	j := q.add(pc)
+	i := &m.p.insts[pc]
+	switch i.op {
+	case instFail:
+	case instNop:
+		m.add(q, i.out, pos, caps, ctx)
+	case instAlt:
+		m.add(q, i.out, pos, caps, ctx)
+		m.add(q, i.arg, pos, caps, ctx)
+	case instEmpty:
+		if emptyOp(i.arg)&^ctx == 0 {
+			m.add(q, i.out, pos, caps, ctx)
 		}
-		s.firstChild.collectSubmatches(in, submatches)
-	case *choiceState:
-		for _, c := range s.choices {
-			c.collectSubmatches(in, submatches)
+	case instSave:
+		old := caps[i.arg]
+		caps[i.arg] = pos
+		m.add(q, i.out, pos, caps, ctx)
+		caps[i.arg] = old
+	case instProgress:
+		m.add(q, i.out, pos, caps, ctx)
+	case instLook:
+		if m.p.looks[i.arg].matches(m.in, pos, &m.looks) {
+			m.add(q, i.out, pos, caps, ctx)
 		}
+	case instMatch, instChar, instBracket:
+		t := m.alloc()
+		copy(t.caps, caps)
+		q.dense[j].t = t
 	}
-	n.next.collectSubmatches(in, submatches)
 }
 
 type charRange struct {
-	from byte
-	to   byte
+	from rune
+	to   rune
 }
 
-func (r charRange) inRange(c byte) bool {
+func (r charRange) inRange(c rune) bool {
 	return c >= r.from && c <= r.to
 }
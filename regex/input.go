@@ -0,0 +1,106 @@
+package regex
+
+import (
+	"io"
+	"slices"
+	"unicode/utf8"
+)
+
+// input abstracts over the different kinds of text the engines can search, so that neither []byte nor
+// io.RuneReader have to be converted to a string first. all positions are byte offsets into the text
+type input interface {
+	// step decodes the rune starting at pos, it returns -1 and a width of 0 at the end of the input
+	step(pos int) (rune, int)
+	// before decodes the rune ending at pos, it returns -1 and a width of 0 at the start of the input
+	before(pos int) (rune, int)
+}
+
+type inputString string
+
+func (in inputString) step(pos int) (rune, int) {
+	if pos >= len(in) {
+		return -1, 0
+	}
+	if c := in[pos]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(string(in[pos:]))
+}
+
+func (in inputString) before(pos int) (rune, int) {
+	if pos <= 0 {
+		return -1, 0
+	}
+	return utf8.DecodeLastRuneInString(string(in[:pos]))
+}
+
+type inputBytes []byte
+
+func (in inputBytes) step(pos int) (rune, int) {
+	if pos >= len(in) {
+		return -1, 0
+	}
+	if c := in[pos]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRune(in[pos:])
+}
+
+func (in inputBytes) before(pos int) (rune, int) {
+	if pos <= 0 {
+		return -1, 0
+	}
+	return utf8.DecodeLastRune(in[:pos])
+}
+
+// inputReader reads runes from r as they are needed.
+// the pike VM only ever moves forward, so usually only the most recently read runes are kept.
+// the backtracker and look-around assertions jump around in the input, so if keep is set all runes read so far are kept
+type inputReader struct {
+	r    io.RuneReader
+	keep bool
+	// the runes read so far (or only the most recent ones), with the byte offsets they start at
+	runes   []rune
+	offsets []int
+	// byte offset of the next rune to be read from r
+	next int
+	eof  bool
+}
+
+func newInputReader(r io.RuneReader, keep bool) *inputReader {
+	return &inputReader{r: r, keep: keep}
+}
+
+func (in *inputReader) step(pos int) (rune, int) {
+	for !in.eof && pos >= in.next {
+		c, w, err := in.r.ReadRune()
+		if err != nil || w == 0 {
+			in.eof = true
+			break
+		}
+		if !in.keep && len(in.runes) >= 2 {
+			in.runes, in.offsets = in.runes[1:], in.offsets[1:]
+		}
+		in.runes = append(in.runes, c)
+		in.offsets = append(in.offsets, in.next)
+		in.next += w
+	}
+
+	i, found := slices.BinarySearch(in.offsets, pos)
+	if !found {
+		return -1, 0
+	}
+	end := in.next
+	if i+1 < len(in.offsets) {
+		end = in.offsets[i+1]
+	}
+	return in.runes[i], end - pos
+}
+
+func (in *inputReader) before(pos int) (rune, int) {
+	i, _ := slices.BinarySearch(in.offsets, pos)
+	if i == 0 {
+		return -1, 0
+	}
+	return in.runes[i-1], pos - in.offsets[i-1]
+}
@@ -0,0 +1,48 @@
+package regex
+
+import (
+	"iter"
+	"slices"
+)
+
+// Match is a single match of the pattern, as yielded by All
+type Match struct {
+	Offset int
+	Str    string
+	// the groups of the match, laid out like the result of FindSubmatch
+	Submatches []Submatch
+}
+
+// the iterators search the text lazily, one match at a time, and stop as soon as the caller stops iterating.
+// they yield the same matches as the corresponding FindAll methods
+
+// All returns an iterator over the successive, non-overlapping matches in s and their index
+func (re Regex) All(s string) iter.Seq2[int, Match] {
+	return func(yield func(int, Match) bool) {
+		i := 0
+		re.eachMatch(inputString(s), len(s), -1, true, func(caps []int) bool {
+			match := Match{Offset: caps[0], Str: s[caps[0]:caps[1]], Submatches: submatchesOf(s, caps)}
+			i++
+			return yield(i-1, match)
+		})
+	}
+}
+
+// AllIndex returns an iterator over the offsets of the successive, non-overlapping matches in s and their groups,
+// each laid out like the result of FindSubmatchIndex
+func (re Regex) AllIndex(s string) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.eachMatch(inputString(s), len(s), -1, true, func(caps []int) bool {
+			return yield(slices.Clone(caps))
+		})
+	}
+}
+
+// AllIndexBytes is like AllIndex, but searches b
+func (re Regex) AllIndexBytes(b []byte) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.eachMatch(inputBytes(b), len(b), -1, true, func(caps []int) bool {
+			return yield(slices.Clone(caps))
+		})
+	}
+}
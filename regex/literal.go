@@ -0,0 +1,331 @@
+package regex
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the literal analysis finds text that every match has to contain. before running an engine, the search
+// jumps straight to the positions where a match can start using strings.Index and friends, which is much faster
+// than starting a thread at every position
+
+// prefilter holds the result of the literal analysis of a pattern
+type prefilter struct {
+	// every match starts with prefix, complete is set if the pattern matches exactly prefix
+	prefix   string
+	complete bool
+	// every match contains inner, starting at most innerBefore runes after the start of the match.
+	// innerBefore is math.MaxInt if that distance is unbounded
+	inner       string
+	innerBefore int
+	// every match starts with one of the literals in leading, nil if there are none
+	leading *ahoCorasick
+	// every match starts with one of these bytes, nil if the pattern can match the empty string or invalid UTF-8
+	first *[256]bool
+}
+
+// literalInput is implemented by inputs that hold all of their text, so that it can be searched for literals directly
+type literalInput interface {
+	// length returns the length of the text in bytes
+	length() int
+	// index returns the offset of the first occurrence of lit at or after pos, or -1 if there is none
+	index(lit string, pos int) int
+	// indexByteSet returns the offset of the first byte in set at or after pos, or -1 if there is none
+	indexByteSet(set *[256]bool, pos int) int
+	// indexAny returns the position of the leftmost occurrence of a literal of ac at or after pos, see acIndex
+	indexAny(ac *ahoCorasick, pos int) int
+}
+
+func (in inputString) length() int {
+	return len(in)
+}
+
+func (in inputString) index(lit string, pos int) int {
+	if i := strings.Index(string(in[pos:]), lit); i >= 0 {
+		return pos + i
+	}
+	return -1
+}
+
+func (in inputString) indexByteSet(set *[256]bool, pos int) int {
+	for i := pos; i < len(in); i++ {
+		if set[in[i]] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (in inputString) indexAny(ac *ahoCorasick, pos int) int {
+	return acIndex(ac, string(in), pos)
+}
+
+func (in inputBytes) length() int {
+	return len(in)
+}
+
+func (in inputBytes) index(lit string, pos int) int {
+	if i := bytes.Index(in[pos:], []byte(lit)); i >= 0 {
+		return pos + i
+	}
+	return -1
+}
+
+func (in inputBytes) indexByteSet(set *[256]bool, pos int) int {
+	for i := pos; i < len(in); i++ {
+		if set[in[i]] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (in inputBytes) indexAny(ac *ahoCorasick, pos int) int {
+	return acIndex(ac, []byte(in), pos)
+}
+
+// possible reports whether a match can start at or after pos, by checking that the inner literal occurs
+func (f *prefilter) possible(in literalInput, pos int) bool {
+	return f.inner == "" || in.index(f.inner, pos) >= 0
+}
+
+// next returns the first position at or after pos at which a match can start, or -1 if there is none
+func (f *prefilter) next(in input, lit literalInput, pos int) int {
+	switch {
+	case f.prefix != "":
+		return lit.index(f.prefix, pos)
+	case f.leading != nil:
+		return lit.indexAny(f.leading, pos)
+	case f.first != nil:
+		return lit.indexByteSet(f.first, pos)
+	case f.inner != "" && f.innerBefore != math.MaxInt:
+		k := lit.index(f.inner, pos)
+		if k < 0 {
+			return -1
+		}
+		// the match starts at most innerBefore runes before the inner literal
+		for n := 0; n < f.innerBefore && k > pos; n++ {
+			_, w := in.before(k)
+			k -= w
+		}
+		return max(k, pos)
+	}
+	return pos
+}
+
+// analyseLiterals computes the prefilter of the pattern parsed into root and compiled into p
+func analyseLiterals(root *node, p *prog) prefilter {
+	a := literalAnalysis{complete: true}
+	a.seq(root)
+	a.endRun()
+
+	f := prefilter{complete: a.complete && len(a.runs) == 0}
+	if len(a.runs) > 0 && a.runs[0].before == 0 {
+		f.prefix = a.runs[0].lit
+		f.complete = a.complete
+	}
+	for _, r := range a.runs {
+		if len(r.lit) > len(f.inner) {
+			f.inner, f.innerBefore = r.lit, r.before
+		}
+	}
+	if f.prefix == "" {
+		// alternations of literals are found in a single pass, instead of trying every branch at every position
+		if lits := leadingLiterals(root); len(lits) > 1 {
+			f.leading = newAhoCorasick(lits)
+		} else {
+			f.first = firstBytes(p)
+		}
+	}
+	return f
+}
+
+// leadingLiterals returns literals of which every match of n and its successors starts with one,
+// or nil if there are none
+func leadingLiterals(n *node) []string {
+	a := literalAnalysis{}
+	a.seq(n)
+	a.endRun()
+	if len(a.runs) > 0 && a.runs[0].before == 0 {
+		return []string{a.runs[0].lit}
+	}
+
+	// skip zero-width nodes
+	for n != nil {
+		switch n.state.(type) {
+		case *flagState, *assertState, *lookState:
+			n = n.next
+			continue
+		}
+		break
+	}
+	if n == nil || n.mi != 1 || n.ma != 1 {
+		return nil
+	}
+
+	switch s := n.state.(type) {
+	case *groupState:
+		return leadingLiterals(s.firstChild)
+	case *choiceState:
+		var lits []string
+		for _, c := range s.choices {
+			cLits := leadingLiterals(c)
+			if cLits == nil {
+				return nil
+			}
+			lits = append(lits, cLits...)
+		}
+		return lits
+	}
+	return nil
+}
+
+// literalRun is a literal every match contains, starting at most before runes after the start of the match
+type literalRun struct {
+	lit    string
+	before int
+}
+
+type literalAnalysis struct {
+	runs []literalRun
+	// the run that is currently being extended
+	cur       strings.Builder
+	curBefore int
+	// maximum number of runes matched by the nodes seen so far
+	width int
+	// only literal characters were seen so far
+	complete bool
+}
+
+// seq analyses n and its successors, which are matched one after the other
+func (a *literalAnalysis) seq(n *node) {
+	for ; n != nil; n = n.next {
+		switch s := n.state.(type) {
+		case *charState:
+			if n.mi >= 1 && n.mi <= n.ma && isLiteralChar(s.char, n.flags) {
+				if a.cur.Len() == 0 {
+					a.curBefore = a.width
+				}
+				for range n.mi {
+					a.cur.WriteRune(s.char)
+				}
+				a.width = saturatingAdd(a.width, n.mi)
+				if n.ma != n.mi {
+					// the following text isn't adjacent to the literal anymore
+					a.endRun()
+					a.complete = false
+					a.width = saturatingAdd(a.width, n.ma-n.mi)
+				}
+				continue
+			}
+		case *groupState:
+			if n.mi == 1 && n.ma == 1 {
+				a.seq(s.firstChild)
+				continue
+			}
+		case *flagState:
+			continue
+		case *assertState, *lookState:
+			// zero-width, the text around them is still adjacent
+			a.complete = false
+			continue
+		}
+
+		// anything else ends the current run
+		a.endRun()
+		a.complete = false
+		single := *n
+		single.next = nil
+		_, ma := runeWidth(&single)
+		a.width = saturatingAdd(a.width, ma)
+	}
+}
+
+func (a *literalAnalysis) endRun() {
+	if a.cur.Len() > 0 {
+		a.runs = append(a.runs, literalRun{lit: a.cur.String(), before: a.curBefore})
+		a.cur.Reset()
+	}
+}
+
+// isLiteralChar reports whether c matches exactly its own UTF-8 encoding under the flags fl
+func isLiteralChar(c rune, fl flags) bool {
+	if c == utf8.RuneError {
+		// also matches invalid UTF-8
+		return false
+	}
+	return fl&flagFoldCase == 0 || unicode.SimpleFold(c) == c
+}
+
+// firstBytes returns the set of bytes a match of p can start with,
+// or nil if p can match the empty string, invalid UTF-8 or if a backreference comes first
+func firstBytes(p *prog) *[256]bool {
+	set := new([256]bool)
+	seen := make([]bool, len(p.insts))
+	var visit func(pc int) bool
+	visit = func(pc int) bool {
+		if seen[pc] {
+			return true
+		}
+		seen[pc] = true
+		i := &p.insts[pc]
+		switch i.op {
+		case instFail:
+			return true
+		case instNop, instSave, instProgress, instEmpty, instLook:
+			// assertions only restrict where a match starts, ignoring them gives a superset
+			return visit(i.out)
+		case instAlt:
+			return visit(i.out) && visit(i.arg)
+		case instChar:
+			if i.char == utf8.RuneError {
+				return false
+			}
+			set[leadByte(i.char)] = true
+			return true
+		case instBracket:
+			ranges := i.ranges
+			if i.negate {
+				ranges = negateCharRanges(ranges)
+			}
+			for _, r := range ranges {
+				if r.inRange(utf8.RuneError) {
+					return false
+				}
+				// utf8 preserves the order of runes, so the leading bytes of a range are a range as well
+				for b := leadByte(r.from); b <= leadByte(r.to); b++ {
+					set[b] = true
+				}
+			}
+			return true
+		}
+		// instMatch and instBackref can match the empty string
+		return false
+	}
+	if !visit(p.start) {
+		return nil
+	}
+	return set
+}
+
+// leadByte returns the first byte of the UTF-8 encoding of c
+func leadByte(c rune) int {
+	switch {
+	case c < 0x80:
+		return int(c)
+	case c < 0x800:
+		return 0xc0 | int(c>>6)
+	case c < 0x10000:
+		return 0xe0 | int(c>>12)
+	}
+	return 0xf0 | int(c>>18)
+}
+
+// LiteralPrefix returns a literal string that every match starts with.
+// complete is true if the pattern matches exactly this string and nothing else
+func (re Regex) LiteralPrefix() (prefix string, complete bool) {
+	return re.prog.pre.prefix, re.prog.pre.complete
+}
@@ -0,0 +1,141 @@
+package regex
+
+// look-around assertions are compiled into their own program, which is run at the position of the assertion.
+// only whether the program matches is of interest, so captures inside of look-around assertions are never reported
+// and the program is simulated as a plain NFA without any priorities
+
+type look struct {
+	prog   *prog
+	behind bool
+	negate bool
+	// bounds of the number of runes matched by a lookbehind
+	minLen int
+	maxLen int
+}
+
+// lookScratch holds the queues used to run the look-around programs, so that they are only allocated once per machine
+type lookScratch struct {
+	queues map[*look]*lookQueues
+	// the machine whose budget the steps of the look-around programs are charged to, nil if there is none
+	budget *machine
+}
+
+type lookQueues struct {
+	runq, nextq queue
+}
+
+// queuesFor returns the queues of the program of l. nested look-around assertions have programs of their own,
+// so the queues of a program are never in use twice at the same time
+func (s *lookScratch) queuesFor(l *look) *lookQueues {
+	q, ok := s.queues[l]
+	if !ok {
+		if s.queues == nil {
+			s.queues = make(map[*look]*lookQueues)
+		}
+		q = &lookQueues{runq: newQueue(len(l.prog.insts)), nextq: newQueue(len(l.prog.insts))}
+		s.queues[l] = q
+	}
+	return q
+}
+
+// charge accounts for n steps of a look-around program, see machine.charge
+func (s *lookScratch) charge(n int) bool {
+	return s.budget == nil || s.budget.charge(n)
+}
+
+// stopped reports whether the search stopped early because the budget is exhausted
+func (s *lookScratch) stopped() bool {
+	return s.budget != nil && s.budget.err != nil
+}
+
+// matches reports whether the assertion holds at the byte offset pos of in
+func (l *look) matches(in input, pos int, s *lookScratch) bool {
+	if !l.behind {
+		return l.prog.reaches(in, pos, -1, s.queuesFor(l), s) != l.negate
+	}
+
+	// try all bounded starting positions before pos, the match has to end exactly at pos
+	start := pos
+	for n := 0; n <= l.maxLen; n++ {
+		if n >= l.minLen && l.prog.reaches(in, start, pos, s.queuesFor(l), s) {
+			return !l.negate
+		}
+		if start == 0 {
+			break
+		}
+		_, w := in.before(start)
+		start -= w
+	}
+	return l.negate
+}
+
+// reaches reports whether p matches in starting exactly at start, using the queues q.
+// if end is not negative, the match also has to end exactly at end
+func (p *prog) reaches(in input, start, end int, q *lookQueues, s *lookScratch) bool {
+	r := lookRun{p: p, in: in, end: end, s: s}
+	runq, nextq := &q.runq, &q.nextq
+	runq.clear()
+	nextq.clear()
+
+	pos := start
+	r.add(runq, p.start, pos)
+	for !r.matched && len(runq.dense) > 0 {
+		if s.stopped() || end >= 0 && pos >= end {
+			return false
+		}
+		c, w := in.step(pos)
+		if w == 0 {
+			return false
+		}
+
+		for _, e := range runq.dense {
+			i := &p.insts[e.pc]
+			if (i.op == instChar || i.op == instBracket) && i.matches(c) {
+				r.add(nextq, i.out, pos+w)
+			}
+		}
+		runq.clear()
+		runq, nextq = nextq, runq
+		pos += w
+	}
+	return r.matched
+}
+
+// lookRun is the state of a single run of reaches
+type lookRun struct {
+	p       *prog
+	in      input
+	end     int
+	s       *lookScratch
+	matched bool
+}
+
+func (r *lookRun) add(q *queue, pc, pos int) {
+	if r.matched || q.contains(pc) || !r.s.charge(1) {
+		return
+	}
+	q.add(pc)
+
+	i := &r.p.insts[pc]
+	switch i.op {
+	case instNop, instSave, instProgress:
+		r.add(q, i.out, pos)
+	case instAlt:
+		r.add(q, i.out, pos)
+		r.add(q, i.arg, pos)
+	case instEmpty:
+		before, _ := r.in.before(pos)
+		after, _ := r.in.step(pos)
+		if emptyOp(i.arg)&^emptyOpContext(before, after) == 0 {
+			r.add(q, i.out, pos)
+		}
+	case instLook:
+		if r.p.looks[i.arg].matches(r.in, pos, r.s) {
+			r.add(q, i.out, pos)
+		}
+	case instMatch:
+		if r.end < 0 || pos == r.end {
+			r.matched = true
+		}
+	}
+}
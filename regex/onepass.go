@@ -0,0 +1,234 @@
+package regex
+
+import (
+	"slices"
+)
+
+// a one-pass program never has more than one thread that can continue: it is anchored at the start of the text,
+// and at every position the next rune decides which way to go. such programs are run by following that single
+// path, recording the captures along the way, without thread lists or backtracking.
+// the one-pass table is built from the program: for every position a thread can be at after consuming a rune,
+// it holds the instructions that consume the next rune and the unique path of empty transitions leading to them
+
+// onePass is the table of a one-pass program
+type onePass struct {
+	nodes []onePassNode
+	start int
+}
+
+// onePassNode is a position in the program a thread can be at between two runes
+type onePassNode struct {
+	// the runes that can be consumed next, sorted and not overlapping. leaf indexes into leaves
+	ranges []onePassRange
+	leaves []onePassLeaf
+	// the path to the match, nil if there is none
+	match *onePassLeaf
+}
+
+type onePassRange struct {
+	from, to rune
+	leaf     int
+}
+
+// onePassLeaf is the path of empty transitions to an instruction consuming a rune, or to the match
+type onePassLeaf struct {
+	// the zero-width assertions on the path
+	empty emptyOp
+	// the capture slots set on the path
+	saves []int
+	// the node after consuming the rune
+	next int
+}
+
+// compileOnePass returns the one-pass table of p, or nil if p isn't one-pass
+func compileOnePass(p *prog) *onePass {
+	if p.backrefs || len(p.looks) > 0 {
+		return nil
+	}
+
+	op := &onePass{}
+	index := make(map[int]int)
+	var pcs []int
+	nodeAt := func(pc int) int {
+		if i, ok := index[pc]; ok {
+			return i
+		}
+		index[pc] = len(op.nodes)
+		op.nodes = append(op.nodes, onePassNode{})
+		pcs = append(pcs, pc)
+		return len(op.nodes) - 1
+	}
+	op.start = nodeAt(p.start)
+
+	// the loop appends to op.nodes and pcs
+	seen := make([]bool, len(p.insts))
+	for i := 0; i < len(pcs); i++ {
+		w := onePassWalker{p: p, seen: seen}
+		if !w.walk(pcs[i], 0, nil) {
+			return nil
+		}
+		// only the instructions reached from this node have to be forgotten, clearing all of them would make
+		// building the table quadratic in the size of the program
+		for _, pc := range w.visited {
+			seen[pc] = false
+		}
+		// every path from the start has to be anchored at the start of the text. this is checked first,
+		// so that unanchored programs don't pay for building the rest of the table
+		if i == op.start && !w.anchored() {
+			return nil
+		}
+
+		n := onePassNode{match: w.match}
+		for _, l := range w.leaves {
+			leaf := onePassLeaf{empty: l.empty, saves: l.saves, next: nodeAt(p.insts[l.pc].out)}
+			n.leaves = append(n.leaves, leaf)
+			inst := &p.insts[l.pc]
+			ranges := []charRange{{from: inst.char, to: inst.char}}
+			if inst.op == instBracket {
+				ranges = inst.ranges
+				if inst.negate {
+					ranges = negateCharRanges(ranges)
+				}
+			}
+			for _, r := range ranges {
+				n.ranges = append(n.ranges, onePassRange{from: r.from, to: r.to, leaf: len(n.leaves) - 1})
+			}
+		}
+
+		// the next rune has to decide which way to go
+		slices.SortFunc(n.ranges, func(a, b onePassRange) int {
+			return int(a.from - b.from)
+		})
+		for j := 1; j < len(n.ranges); j++ {
+			if n.ranges[j].from <= n.ranges[j-1].to {
+				return nil
+			}
+		}
+		// a match can only compete with consuming a rune if it has to be at the end of the text
+		if n.match != nil && len(n.leaves) > 0 && n.match.empty&emptyEndText == 0 {
+			return nil
+		}
+		op.nodes[i] = n
+	}
+	return op
+}
+
+// onePassWalker follows the empty transitions from a node, collecting the paths to the instructions consuming a rune
+type onePassWalker struct {
+	p *prog
+	// instructions already reached, reaching one twice means there are several paths to it
+	seen []bool
+	// the instructions marked in seen
+	visited []int
+	leaves  []onePassPath
+	match   *onePassLeaf
+}
+
+type onePassPath struct {
+	pc    int
+	empty emptyOp
+	saves []int
+}
+
+// walk follows the empty transitions from pc, with empty and saves collected on the way there.
+// it returns false if an instruction can be reached on several paths
+func (w *onePassWalker) walk(pc int, empty emptyOp, saves []int) bool {
+	if w.seen[pc] {
+		return false
+	}
+	w.seen[pc] = true
+	w.visited = append(w.visited, pc)
+
+	i := &w.p.insts[pc]
+	switch i.op {
+	case instFail:
+		return true
+	case instNop, instProgress:
+		return w.walk(i.out, empty, saves)
+	case instAlt:
+		return w.walk(i.out, empty, saves) && w.walk(i.arg, empty, saves)
+	case instEmpty:
+		return w.walk(i.out, empty|emptyOp(i.arg), saves)
+	case instSave:
+		return w.walk(i.out, empty, append(slices.Clip(saves), i.arg))
+	case instChar, instBracket:
+		w.leaves = append(w.leaves, onePassPath{pc: pc, empty: empty, saves: saves})
+		return true
+	case instMatch:
+		w.match = &onePassLeaf{empty: empty, saves: saves}
+		return true
+	}
+	return false
+}
+
+// anchored reports whether all paths found by the walker require the start of the text
+func (w *onePassWalker) anchored() bool {
+	if w.match != nil && w.match.empty&emptyBeginText == 0 {
+		return false
+	}
+	for _, l := range w.leaves {
+		if l.empty&emptyBeginText == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the leaf consuming c, or nil if there is none
+func (n *onePassNode) find(c rune) *onePassLeaf {
+	if c < 0 {
+		return nil
+	}
+	j, found := slices.BinarySearchFunc(n.ranges, c, func(r onePassRange, c rune) int {
+		if c < r.from {
+			return 1
+		}
+		if c > r.to {
+			return -1
+		}
+		return 0
+	})
+	if !found {
+		return nil
+	}
+	return &n.leaves[n.ranges[j].leaf]
+}
+
+// onePass runs the one-pass program of m.p, see compileOnePass
+func (m *machine) onePass(in input, pos int) bool {
+	op := m.p.onePass
+	m.matched = false
+	for i := range m.matchcap {
+		m.matchcap[i] = -1
+	}
+	m.pending = pos
+
+	n := &op.nodes[op.start]
+	before, _ := in.before(pos)
+	for {
+		if !m.charge(1) {
+			return false
+		}
+		c, w := in.step(pos)
+		ctx := emptyOpContext(before, c)
+		if l := n.match; l != nil && l.empty&^ctx == 0 {
+			for _, slot := range l.saves {
+				m.matchcap[slot] = pos
+			}
+			m.matchcap[1] = pos
+			m.matched = true
+			return true
+		}
+
+		l := n.find(c)
+		if l == nil || l.empty&^ctx != 0 {
+			return false
+		}
+		for _, slot := range l.saves {
+			m.matchcap[slot] = pos
+		}
+		n = &op.nodes[l.next]
+		before = c
+		pos += w
+	}
+}
@@ -6,8 +6,13 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// maximum count of a repetition, like in Go
+const maxRepeat = 1000
+
 type parserError struct {
 	inner   error
 	message string
@@ -21,13 +26,13 @@ func newParserError(i int, str string, inner error) parserError {
 	return parserError{message: fmt.Sprintf("parser error at %d: %s", i, str), inner: inner}
 }
 
-func parse(re string, i int, fromChoice bool, prev *node) (*node, error) {
+func parse(re string, i int, fromChoice bool, prev *node, fl flags) (*node, error) {
 	if i >= len(re) {
 		return nil, nil
 	}
 
 	if !fromChoice {
-		choices, err := parseChoices(re, i)
+		choices, err := parseChoices(re, i, fl)
 		if err != nil {
 			return nil, err
 		}
@@ -40,7 +45,7 @@ func parse(re string, i int, fromChoice bool, prev *node) (*node, error) {
 	}
 
 	// group
-	group, err := parseGroup(re, i)
+	group, err := parseGroup(re, i, fl)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +57,7 @@ func parse(re string, i int, fromChoice bool, prev *node) (*node, error) {
 	}
 
 	// bracket
-	bracket, err := parseBracket(re, i)
+	bracket, err := parseBracket(re, i, fl)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +69,7 @@ func parse(re string, i int, fromChoice bool, prev *node) (*node, error) {
 	}
 
 	// char
-	char, err := parseChar(re, i)
+	char, err := parseChar(re, i, fl)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +83,7 @@ func parse(re string, i int, fromChoice bool, prev *node) (*node, error) {
 }
 
 // ...|...|...
-func parseChoices(re string, i int) (*node, error) {
+func parseChoices(re string, i int, fl flags) (*node, error) {
 	if i >= len(re) {
 		return nil, nil
 	}
@@ -89,7 +94,7 @@ func parseChoices(re string, i int) (*node, error) {
 	var firstChild *node
 	var prevChild *node
 	for j < len(re) {
-		child, err := parse(re, j, true, prevChild)
+		child, err := parse(re, j, true, prevChild, fl)
 		if err != nil {
 			return nil, err
 		}
@@ -101,6 +106,10 @@ func parseChoices(re string, i int) (*node, error) {
 		if firstChild == nil {
 			firstChild = child
 		}
+		// (?flags) applies to the rest of the enclosing group, including the following choices
+		if _, ok := child.state.(*flagState); ok {
+			fl = child.flags
+		}
 
 		if j < len(re) && re[j] == '|' {
 			j += 1
@@ -122,14 +131,18 @@ func parseChoices(re string, i int) (*node, error) {
 		state: &choiceState{
 			choices: choices,
 		},
-		mi:  1,
-		ma:  1,
-		str: re[i:j],
+		mi:    1,
+		ma:    1,
+		flags: fl,
+		str:   re[i:j],
 	}, nil
 }
 
-// (...)
-func parseGroup(re string, i int) (*node, error) {
+// (...), (?:...), (?P<name>...), (?<name>...), (?flags) and (?flags:...)
+// as well as the look-around assertions (?=...), (?!...), (?<=...) and (?<!...)
+// flags are any of i (case-insensitive), m (multi-line), s (dot matches '\n') and U (ungreedy),
+// flags following a '-' are cleared instead of set
+func parseGroup(re string, i int, fl flags) (*node, error) {
 	if i >= len(re) || re[i] != '(' {
 		return nil, nil
 	}
@@ -137,10 +150,52 @@ func parseGroup(re string, i int) (*node, error) {
 	// pop off '('
 	j := i + 1
 
+	capture := true
+	innerFl := fl
+	look, cons := parseLookPrefix(re, j)
+	name, nameCons, err := parseGroupName(re, j)
+	if err != nil && look == nil {
+		return nil, err
+	}
+	if look != nil {
+		j += cons
+		capture = false
+	} else if nameCons > 0 {
+		j += nameCons
+	} else if j < len(re) && re[j] == '?' {
+		newFl, cons, err := parseFlags(re, j+1, fl)
+		if err != nil {
+			return nil, err
+		}
+		j += 1 + cons
+
+		if j >= len(re) {
+			return nil, newParserError(j, "unexpected EOS", nil)
+		}
+
+		// (?flags) changes the flags of everything that follows in the enclosing group
+		if re[j] == ')' {
+			return &node{
+				state: &flagState{},
+				mi:    1,
+				ma:    1,
+				flags: newFl,
+				str:   re[i : j+1],
+			}, nil
+		}
+
+		if re[j] != ':' {
+			return nil, newParserError(j, "invalid group flags", nil)
+		}
+		j++
+		capture = false
+		innerFl = newFl
+	}
+
 	var firstChild *node
 	var prevChild *node
 	for j < len(re) && re[j] != ')' {
-		child, err := parse(re, j, false, prevChild)
+		child, err := parse(re, j, false, prevChild, innerFl)
 		if err != nil {
 			return nil, err
 		}
@@ -152,6 +207,9 @@ func parseGroup(re string, i int) (*node, error) {
 		if firstChild == nil {
 			firstChild = child
 		}
+		if _, ok := child.state.(*flagState); ok {
+			innerFl = child.flags
+		}
 	}
 
 	if j >= len(re) {
@@ -166,24 +224,165 @@ func parseGroup(re string, i int) (*node, error) {
 	j++
 
 	// see if there is a Quantifier
-	mi, ma, cons, err := parseQuantifier(re, j)
+	mi, ma, lazy, cons, err := parseQuantifier(re, j)
 	if err != nil {
 		return nil, err
 	}
+
+	var state any = &groupState{
+		firstChild: firstChild,
+		capture:    capture,
+		name:       name,
+	}
+	if look != nil {
+		look.firstChild = firstChild
+		if look.behind {
+			look.minLen, look.maxLen = runeWidth(firstChild)
+			if look.maxLen == math.MaxInt {
+				return nil, newParserError(i, "lookbehind must match a bounded number of characters", nil)
+			}
+		}
+		state = look
+	}
+
 	return &node{
-		state: &groupState{
-			firstChild: firstChild,
-		},
-		mi:  mi,
-		ma:  ma,
-		str: re[i : j+cons],
+		state: state,
+		mi:    mi,
+		ma:    ma,
+		lazy:  lazy,
+		flags: fl,
+		str:   re[i : j+cons],
 	}, nil
 }
 
+// parses the ?=, ?!, ?<= or ?<! of a look-around assertion starting at i, right after the '('
+// returns nil if there is none
+func parseLookPrefix(re string, i int) (*lookState, int) {
+	switch {
+	case strings.HasPrefix(re[i:], "?="):
+		return &lookState{}, 2
+	case strings.HasPrefix(re[i:], "?!"):
+		return &lookState{negate: true}, 2
+	case strings.HasPrefix(re[i:], "?<="):
+		return &lookState{behind: true}, 3
+	case strings.HasPrefix(re[i:], "?<!"):
+		return &lookState{behind: true, negate: true}, 3
+	}
+	return nil, 0
+}
+
+// runeWidth returns the minimum and maximum number of runes matched by n and its successors.
+// the maximum is math.MaxInt if it is unbounded
+func runeWidth(n *node) (int, int) {
+	mi, ma := 0, 0
+	for ; n != nil; n = n.next {
+		atomMi, atomMa := 0, 0
+		switch s := n.state.(type) {
+		case *charState, *bracketState:
+			atomMi, atomMa = 1, 1
+		case *groupState:
+			atomMi, atomMa = runeWidth(s.firstChild)
+		case *choiceState:
+			atomMi = math.MaxInt
+			for _, c := range s.choices {
+				cMi, cMa := runeWidth(c)
+				atomMi, atomMa = min(atomMi, cMi), max(atomMa, cMa)
+			}
+		case *backrefState:
+			atomMa = math.MaxInt
+		}
+
+		mi = saturatingAdd(mi, saturatingMul(atomMi, n.mi))
+		ma = saturatingAdd(ma, saturatingMul(atomMa, n.ma))
+	}
+	return mi, ma
+}
+
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > math.MaxInt/b {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// parses the ?P<name> or ?<name> of a named group starting at i, right after the '('
+// returns the name and the number of consumed bytes, or 0 if there is no name
+func parseGroupName(re string, i int) (string, int, error) {
+	j := i
+	if strings.HasPrefix(re[j:], "?P<") {
+		j += 3
+	} else if strings.HasPrefix(re[j:], "?<") {
+		j += 2
+	} else {
+		return "", 0, nil
+	}
+
+	end := strings.IndexByte(re[j:], '>')
+	if end == -1 {
+		return "", 0, newParserError(j, "did not find closing '>'", nil)
+	}
+
+	name := re[j : j+end]
+	if name == "" {
+		return "", 0, newParserError(j, "empty group name", nil)
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return "", 0, newParserError(j, fmt.Sprintf("invalid group name %q", name), nil)
+		}
+	}
+	return name, j + end + 1 - i, nil
+}
+
+// parses the flags of (?flags) or (?flags:...) starting at i, right after the '?'
+// returns the new flags and the number of consumed bytes, stopping at the ')' or ':'
+func parseFlags(re string, i int, fl flags) (flags, int, error) {
+	j := i
+	clear := false
+	for ; j < len(re) && re[j] != ')' && re[j] != ':'; j++ {
+		var f flags
+		switch re[j] {
+		case 'i':
+			f = flagFoldCase
+		case 'm':
+			f = flagMultiLine
+		case 's':
+			f = flagDotNL
+		case 'U':
+			f = flagUngreedy
+		case '-':
+			if clear {
+				return 0, 0, newParserError(j, "invalid group flags", nil)
+			}
+			clear = true
+			continue
+		default:
+			return 0, 0, newParserError(j, fmt.Sprintf("unknown group flag %q", re[j]), nil)
+		}
+
+		if clear {
+			fl &^= f
+		} else {
+			fl |= f
+		}
+	}
+	return fl, j - i, nil
+}
+
 // [...] and [^...]
 // this doesn't conform to POSIX, as we allow perl character sets, which mandates that '\' is not treated literally
 // inside of bracket expressions, make sure to escape '^', '-', ']' and '\'
-func parseBracket(re string, i int) (*node, error) {
+func parseBracket(re string, i int, fl flags) (*node, error) {
 	if i >= len(re) {
 		return nil, nil
 	}
@@ -204,7 +403,7 @@ func parseBracket(re string, i int) (*node, error) {
 	// we require them to be escape for now (not as pretty but semantically equivalent, just requires that you escape them)
 	// this means that we will assume that an unescaped ']' means that the bracket expression is over
 
-	var q []byte
+	var q []rune
 	ranges := make([]charRange, 0)
 	for j < len(re) && re[j] != ']' {
 		if re[j] == '[' {
@@ -215,17 +414,30 @@ func parseBracket(re string, i int) (*node, error) {
 			j += cons
 			ranges = append(ranges, rs...)
 		} else if re[j] == '\\' {
+			class, cons, err := parseUnicodeClass(re, j)
+			if err != nil {
+				return nil, err
+			}
+			if class != nil {
+				ranges = append(ranges, class...)
+				j += cons
+				continue
+			}
+
 			rs := parsePerlCharSet(re, j)
 			if rs != nil {
 				ranges = append(ranges, rs...)
+				j += 2
 			} else {
-				c := escapedChar(re[j+1])
+				c, size := utf8.DecodeRuneInString(re[j+1:])
+				c = escapedChar(c)
 				ranges = append(ranges, charRange{from: c, to: c})
+				j += 1 + size
 			}
-			j += 2
 		} else {
-			q = append(q, re[j])
-			j += 1
+			c, size := utf8.DecodeRuneInString(re[j:])
+			q = append(q, c)
+			j += size
 
 			// reduce
 			// todo: allow unescaped - at end and start
@@ -253,15 +465,17 @@ func parseBracket(re string, i int) (*node, error) {
 	j += 1
 
 	// see if there is a Quantifier
-	mi, ma, cons, err := parseQuantifier(re, j)
+	mi, ma, lazy, cons, err := parseQuantifier(re, j)
 	if err != nil {
 		return nil, err
 	}
 
 	return &node{
-		state: &bracketState{negate: negate, ranges: ranges},
+		state: &bracketState{negate: negate, ranges: normalizeCharRanges(ranges)},
 		mi:    mi,
 		ma:    ma,
+		lazy:  lazy,
+		flags: fl,
 		str:   re[i : j+cons],
 	}, nil
 }
@@ -425,7 +639,102 @@ func parsePerlCharSet(re string, i int) []charRange {
 	return nil
 }
 
-func parseChar(re string, i int) (*node, error) {
+// \pN, \p{Name} and \p{^Name}, as well as their negations \PN, \P{Name} and \P{^Name}
+// Name can be any general category (e.g. L, Lu, N) or script (e.g. Greek, Latin) of the unicode package, or Any
+// returns nil if there is no unicode class at i
+func parseUnicodeClass(re string, i int) ([]charRange, int, error) {
+	if i+1 >= len(re) || re[i] != '\\' || (re[i+1] != 'p' && re[i+1] != 'P') {
+		return nil, 0, nil
+	}
+	negate := re[i+1] == 'P'
+
+	j := i + 2
+	if j >= len(re) {
+		return nil, 0, newParserError(j, "unexpected EOS", nil)
+	}
+
+	var name string
+	if re[j] == '{' {
+		end := strings.IndexByte(re[j:], '}')
+		if end == -1 {
+			return nil, 0, newParserError(j, "did not find closing '}'", nil)
+		}
+		name = re[j+1 : j+end]
+		j += end + 1
+	} else {
+		_, size := utf8.DecodeRuneInString(re[j:])
+		name = re[j : j+size]
+		j += size
+	}
+
+	if strings.HasPrefix(name, "^") {
+		negate = !negate
+		name = name[1:]
+	}
+
+	var ranges []charRange
+	if name == "Any" {
+		ranges = []charRange{{from: 0, to: unicode.MaxRune}}
+	} else if table, ok := unicode.Categories[name]; ok {
+		ranges = rangeTableToCharRanges(table)
+	} else if table, ok := unicode.Scripts[name]; ok {
+		ranges = rangeTableToCharRanges(table)
+	} else {
+		return nil, 0, newParserError(i, fmt.Sprintf("unknown unicode class %q", name), nil)
+	}
+
+	if negate {
+		ranges = negateCharRanges(ranges)
+	}
+	return ranges, j - i, nil
+}
+
+func rangeTableToCharRanges(table *unicode.RangeTable) []charRange {
+	var ranges []charRange
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			ranges = append(ranges, charRange{from: lo, to: hi})
+			return
+		}
+		for c := lo; c <= hi; c += stride {
+			ranges = append(ranges, charRange{from: c, to: c})
+		}
+	}
+	for _, r := range table.R16 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range table.R32 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	return normalizeCharRanges(ranges)
+}
+
+// \1 to \9 and \k<name>
+// returns nil if there is no backreference at i
+func parseBackref(re string, i int) (*backrefState, int, error) {
+	if i+1 >= len(re) || re[i] != '\\' {
+		return nil, 0, nil
+	}
+
+	if c := re[i+1]; c >= '1' && c <= '9' {
+		return &backrefState{index: int(c - '0')}, 2, nil
+	}
+
+	if !strings.HasPrefix(re[i+1:], "k<") {
+		return nil, 0, nil
+	}
+	end := strings.IndexByte(re[i+3:], '>')
+	if end == -1 {
+		return nil, 0, newParserError(i+3, "did not find closing '>'", nil)
+	}
+	name := re[i+3 : i+3+end]
+	if name == "" {
+		return nil, 0, newParserError(i+3, "empty group name", nil)
+	}
+	return &backrefState{name: name}, 3 + end + 1, nil
+}
+
+func parseChar(re string, i int, fl flags) (*node, error) {
 	if i >= len(re) {
 		return nil, nil
 	}
@@ -434,22 +743,39 @@ func parseChar(re string, i int) (*node, error) {
 		// don't consume non-escaped meta characters
 		switch re[i] {
 		case '^', '$':
-			return nil, newParserError(i, "unexpected meta character", nil)
+			var op emptyOp
+			switch {
+			case re[i] == '^' && fl&flagMultiLine != 0:
+				op = emptyBeginLine
+			case re[i] == '^':
+				op = emptyBeginText
+			case fl&flagMultiLine != 0:
+				op = emptyEndLine
+			default:
+				op = emptyEndText
+			}
+			mi, ma, lazy, cons, err := parseQuantifier(re, i+1)
+			if err != nil {
+				return nil, err
+			}
+			return &node{state: &assertState{op: op}, mi: mi, ma: ma, lazy: lazy, flags: fl, str: re[i : i+1+cons]}, nil
 		case '(', ')', '{', '}', '[', ']', '|', '?', '+', '*':
 			return nil, nil
 		}
 
-		mi, ma, cons, err := parseQuantifier(re, i+1)
+		c, size := utf8.DecodeRuneInString(re[i:])
+		mi, ma, lazy, cons, err := parseQuantifier(re, i+size)
 		if err != nil {
 			return nil, err
 		}
 
-		c := re[i]
 		node := &node{
 			state: &charState{char: c},
 			mi:    mi,
 			ma:    ma,
-			str:   re[i : i+1+cons],
+			lazy:  lazy,
+			flags: fl,
+			str:   re[i : i+size+cons],
 		}
 		// have to differentiate between literal '\.' and wildcard '.'
 		if re[i] == '.' {
@@ -457,14 +783,54 @@ func parseChar(re string, i int) (*node, error) {
 				negate: true,
 				ranges: []charRange{{from: '\n', to: '\n'}},
 			}
+			if fl&flagDotNL != 0 {
+				node.state = &bracketState{negate: true}
+			}
 		}
 		return node, nil
 	}
 
 	// if re[i] == '\'
 	if i+1 < len(re) {
+		// try to parse unicode class
+		class, classCons, err := parseUnicodeClass(re, i)
+		if err != nil {
+			return nil, err
+		}
+		if class != nil {
+			mi, ma, lazy, cons, err := parseQuantifier(re, i+classCons)
+			if err != nil {
+				return nil, err
+			}
+			return &node{state: &bracketState{ranges: class}, mi: mi, ma: ma, lazy: lazy, flags: fl, str: re[i : i+classCons+cons]}, nil
+		}
+
+		// try to parse zero-width assertion
+		if op, ok := escapedAssertion(re[i+1]); ok {
+			mi, ma, lazy, cons, err := parseQuantifier(re, i+2)
+			if err != nil {
+				return nil, err
+			}
+			return &node{state: &assertState{op: op}, mi: mi, ma: ma, lazy: lazy, flags: fl, str: re[i : i+2+cons]}, nil
+		}
+
+		// try to parse backreference
+		backref, backrefCons, err := parseBackref(re, i)
+		if err != nil {
+			return nil, err
+		}
+		if backref != nil {
+			mi, ma, lazy, cons, err := parseQuantifier(re, i+backrefCons)
+			if err != nil {
+				return nil, err
+			}
+			return &node{state: backref, mi: mi, ma: ma, lazy: lazy, flags: fl, str: re[i : i+backrefCons+cons]}, nil
+		}
+
+		c, size := utf8.DecodeRuneInString(re[i+1:])
+
 		// we always want to parse a quantifier
-		mi, ma, cons, err := parseQuantifier(re, i+2)
+		mi, ma, lazy, cons, err := parseQuantifier(re, i+1+size)
 		if err != nil {
 			return nil, err
 		}
@@ -472,22 +838,36 @@ func parseChar(re string, i int) (*node, error) {
 		// try to parse perl char set
 		charSet := parsePerlCharSet(re, i)
 		if charSet != nil {
-			return &node{state: &bracketState{ranges: charSet}, mi: mi, ma: ma, str: re[i : i+2+cons]}, nil
+			return &node{state: &bracketState{ranges: normalizeCharRanges(charSet)}, mi: mi, ma: ma, lazy: lazy, flags: fl, str: re[i : i+1+size+cons]}, nil
 		}
 
 		// otherwise treat as an escaped literal
 		return &node{
-			state: &charState{char: escapedChar(re[i+1])},
+			state: &charState{char: escapedChar(c)},
 			mi:    mi,
 			ma:    ma,
-			str:   re[i : i+2+cons],
+			lazy:  lazy,
+			flags: fl,
+			str:   re[i : i+1+size+cons],
 		}, nil
 	}
 	return nil, newParserError(i, "unexpected EOS", nil)
 }
 
-// {m, n} and ? and * and +
-func parseQuantifier(re string, i int) (mi int, ma int, consumed int, err error) {
+// {m, n} and ? and * and +, each optionally followed by a '?' to make it lazy
+func parseQuantifier(re string, i int) (mi int, ma int, lazy bool, consumed int, err error) {
+	mi, ma, consumed, err = parseGreedyQuantifier(re, i)
+	if err != nil || consumed == 0 {
+		return mi, ma, false, consumed, err
+	}
+
+	if i+consumed < len(re) && re[i+consumed] == '?' {
+		return mi, ma, true, consumed + 1, nil
+	}
+	return mi, ma, false, consumed, nil
+}
+
+func parseGreedyQuantifier(re string, i int) (mi int, ma int, consumed int, err error) {
 	if i >= len(re) {
 		return 1, 1, 0, nil
 	}
@@ -521,6 +901,10 @@ func parseQuantifier(re string, i int) (mi int, ma int, consumed int, err error)
 		return 0, 0, 0, newParserError(i, "failed to convert to number", err)
 	}
 
+	if occMin > maxRepeat {
+		return 0, 0, 0, newParserError(i, fmt.Sprintf("repeat count %d is larger than %d", occMin, maxRepeat), nil)
+	}
+
 	if len(numStrs) == 1 {
 		return occMin, occMin, 1 + endIdx, nil
 	}
@@ -529,32 +913,72 @@ func parseQuantifier(re string, i int) (mi int, ma int, consumed int, err error)
 	if err != nil {
 		return 0, 0, 0, newParserError(i, "failed to convert to number", err)
 	}
+	if occMax > maxRepeat {
+		return 0, 0, 0, newParserError(i, fmt.Sprintf("repeat count %d is larger than %d", occMax, maxRepeat), nil)
+	}
 
 	return occMin, occMax, 1 + endIdx, nil
 }
 
+// normalizeCharRanges sorts ranges and merges overlapping or adjacent ones, so that they can be binary searched
+func normalizeCharRanges(ranges []charRange) []charRange {
+	slices.SortFunc(ranges, func(a, b charRange) int {
+		return int(a.from) - int(b.from)
+	})
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.from <= merged[n-1].to+1 {
+			merged[n-1].to = max(merged[n-1].to, r.to)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
 func negateCharRanges(ranges []charRange) []charRange {
-	newRanges := make([]charRange, len(ranges))
+	newRanges := make([]charRange, 0, len(ranges)+1)
 
 	// assumes that intervals don't overlap
 	slices.SortFunc(ranges, func(a, b charRange) int {
 		return int(a.from) - int(b.from)
 	})
 
-	from := byte(0)
+	from := rune(0)
 	for _, r := range ranges {
-		newRanges = append(newRanges, charRange{from: from, to: r.from - 1})
-		from = r.to + 1
+		if r.from > from {
+			newRanges = append(newRanges, charRange{from: from, to: r.from - 1})
+		}
+		from = max(from, r.to+1)
+	}
+	if from <= unicode.MaxRune {
+		newRanges = append(newRanges, charRange{from: from, to: unicode.MaxRune})
 	}
-	newRanges = append(newRanges, charRange{from: from, to: 0x7f})
 	return newRanges
 }
 
+// \A, \z, \b and \B outside of bracket expressions
+// should be called if the character preceding c in the input string is '\'
+func escapedAssertion(c byte) (emptyOp, bool) {
+	switch c {
+	case 'A':
+		return emptyBeginText, true
+	case 'z':
+		return emptyEndText, true
+	case 'b':
+		return emptyWordBoundary, true
+	case 'B':
+		return emptyNoWordBoundary, true
+	}
+	return 0, false
+}
+
 // parse an ASCII escape sequence from c if there is one (e.g. '\t', '\n', ...)
 // if c isn't an ASCII escape sequence, return c
 // should be called if the character preceding c in the input string is '\'
 // https://en.wikipedia.org/wiki/Escape_sequences_in_C
-func escapedChar(c byte) byte {
+func escapedChar(c rune) rune {
 	switch c {
 	case 'a':
 		return '\a'
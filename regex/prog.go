@@ -0,0 +1,551 @@
+package regex
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"unicode"
+)
+
+// instOp is the operation of a single instruction in a compiled program
+type instOp uint8
+
+const (
+	// successfully matched the whole pattern
+	instMatch instOp = iota
+	// never matches, used for things like x{0}
+	instFail
+	// does nothing, just continues at out
+	instNop
+	// consumes a single rune equal to char
+	instChar
+	// consumes a single rune within ranges (or outside of them if negate is set)
+	instBracket
+	// forks into out (preferred) and arg
+	instAlt
+	// records the current position in capture slot arg
+	instSave
+	// zero-width assertion on the surrounding chars, arg is a bitmask of emptyOp
+	instEmpty
+	// consumes the text captured by group arg, only supported by the backtracker
+	instBackref
+	// fails if loop arg has not consumed anything since its last iteration, otherwise continues at out.
+	// guards loops whose body can match the empty string from looping forever in the backtracker
+	instProgress
+	// zero-width look-around assertion, arg is an index into prog.looks
+	instLook
+)
+
+// emptyOp are the conditions that can be checked by instEmpty
+type emptyOp uint8
+
+const (
+	emptyBeginLine emptyOp = 1 << iota
+	emptyEndLine
+	emptyBeginText
+	emptyEndText
+	emptyWordBoundary
+	emptyNoWordBoundary
+)
+
+// emptyOpContext returns the zero-width conditions satisfied between the runes before and after.
+// before and after are -1 at the beginning and end of the input respectively
+func emptyOpContext(before, after rune) emptyOp {
+	var op emptyOp
+	if before < 0 {
+		op |= emptyBeginText | emptyBeginLine
+	} else if before == '\n' {
+		op |= emptyBeginLine
+	}
+	if after < 0 {
+		op |= emptyEndText | emptyEndLine
+	} else if after == '\n' {
+		op |= emptyEndLine
+	}
+	if isWordChar(before) != isWordChar(after) {
+		op |= emptyWordBoundary
+	} else {
+		op |= emptyNoWordBoundary
+	}
+	return op
+}
+
+// isWordChar reports whether c is an ASCII word character as matched by \w
+func isWordChar(c rune) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+type inst struct {
+	op     instOp
+	out    int
+	arg    int
+	char   rune
+	negate bool
+	ranges []charRange
+	// instBackref compares case-insensitively
+	fold bool
+}
+
+// matches reports whether the rune c is consumed by an instChar or instBracket instruction
+func (in *inst) matches(c rune) bool {
+	switch in.op {
+	case instChar:
+		return c == in.char
+	case instBracket:
+		// ranges are normalized by the parser
+		_, found := slices.BinarySearchFunc(in.ranges, c, func(r charRange, c rune) int {
+			if c < r.from {
+				return 1
+			}
+			if c > r.to {
+				return -1
+			}
+			return 0
+		})
+		return found != in.negate
+	}
+	return false
+}
+
+// prog is the compiled form of a parsed regex, which is executed by the pike VM in engine.go
+type prog struct {
+	insts []inst
+	start int
+	// number of capture slots, two per capture group (including the implicit group 0)
+	numCap int
+	// names of the capture groups, "" for unnamed groups
+	names []string
+	// the program contains instBackref and has to be run by the backtracker
+	backrefs bool
+	// number of loops guarded by instProgress
+	numLoops int
+	// the look-around assertions referenced by instLook
+	looks []*look
+	// maximum number of runes from its start a match depends on, including those examined by lookaheads.
+	// math.MaxInt if it is unbounded
+	reach int
+	// maximum number of runes before its start a match depends on, through lookbehinds
+	behind int
+	// literals used to skip to the positions where a match can start, see literal.go
+	pre prefilter
+	// the program compiled from the reversed pattern, used by the reverse DFA to find where a match starts.
+	// nil if the program can't be run by the DFA
+	reversed *prog
+	// the table used to run the program in a single pass, nil if it isn't one-pass. see onepass.go
+	onePass *onePass
+}
+
+// patch is a dangling output of an instruction, that still has to be pointed at the next instruction.
+// if arg is set, the arg of the instruction is dangling instead of out
+type patch struct {
+	i   int
+	arg bool
+}
+
+// frag is a partially compiled program with a single entry point and a list of dangling outputs
+type frag struct {
+	start int
+	out   []patch
+}
+
+// maximum number of instructions of a program, larger patterns are rejected instead of compiling for a long time
+const maxProgSize = 100000
+
+type compiler struct {
+	p   *prog
+	err error
+	// compile concatenations in reverse order, so that the program matches the reversed text
+	reverse bool
+}
+
+// compileProg compiles the root group returned by the parser into a program
+func compileProg(root *node) (*prog, error) {
+	names := numberGroups(root, nil)
+	c := compiler{p: &prog{numCap: 2 * len(names), names: names}}
+
+	f := c.node(root)
+	match := c.emit(inst{op: instMatch})
+	c.patch(f.out, match)
+	c.p.start = f.start
+	c.p.reach, c.p.behind = reachWidth(root), behindWidth(root)
+	c.p.pre = analyseLiterals(root, c.p)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if !c.p.backrefs && len(c.p.looks) == 0 {
+		c.p.reversed = compileReversed(root, c.p)
+		c.p.onePass = compileOnePass(c.p)
+	}
+	return c.p, nil
+}
+
+// compileReversed compiles the pattern parsed into root so that it matches the reversed text of the matches of p.
+// the reversed program is only run by the reverse DFA, which doesn't care about priorities
+func compileReversed(root *node, p *prog) *prog {
+	c := compiler{p: &prog{numCap: p.numCap, names: p.names}, reverse: true}
+	f := c.node(root)
+	c.patch(f.out, c.emit(inst{op: instMatch}))
+	c.p.start = f.start
+	return c.p
+}
+
+// numberGroups assigns capture indices to all capturing groups in the order of their opening parenthesis.
+// names holds the names of all groups numbered so far, the names of the newly numbered groups are appended
+func numberGroups(n *node, names []string) []string {
+	for ; n != nil; n = n.next {
+		switch s := n.state.(type) {
+		case *groupState:
+			if s.capture {
+				s.index = len(names)
+				names = append(names, s.name)
+			}
+			names = numberGroups(s.firstChild, names)
+		case *choiceState:
+			for _, c := range s.choices {
+				names = numberGroups(c, names)
+			}
+		case *lookState:
+			names = numberGroups(s.firstChild, names)
+		}
+	}
+	return names
+}
+
+func (c *compiler) emit(i inst) int {
+	c.p.insts = append(c.p.insts, i)
+	if len(c.p.insts) > maxProgSize && c.err == nil {
+		c.err = fmt.Errorf("expression too large, it needs more than %d instructions", maxProgSize)
+	}
+	return len(c.p.insts) - 1
+}
+
+func (c *compiler) patch(l []patch, to int) {
+	for _, p := range l {
+		if p.arg {
+			c.p.insts[p.i].arg = to
+		} else {
+			c.p.insts[p.i].out = to
+		}
+	}
+}
+
+func (c *compiler) nop() frag {
+	i := c.emit(inst{op: instNop})
+	return frag{start: i, out: []patch{{i: i}}}
+}
+
+func (c *compiler) fail() frag {
+	return frag{start: c.emit(inst{op: instFail})}
+}
+
+func (c *compiler) empty(op emptyOp) frag {
+	i := c.emit(inst{op: instEmpty, arg: int(op)})
+	return frag{start: i, out: []patch{{i: i}}}
+}
+
+func (c *compiler) save(slot int) frag {
+	i := c.emit(inst{op: instSave, arg: slot})
+	return frag{start: i, out: []patch{{i: i}}}
+}
+
+func (c *compiler) cat(f1, f2 frag) frag {
+	c.patch(f1.out, f2.start)
+	return frag{start: f1.start, out: f2.out}
+}
+
+// alt prefers f1 over f2
+func (c *compiler) alt(f1, f2 frag) frag {
+	i := c.emit(inst{op: instAlt, out: f1.start, arg: f2.start})
+	return frag{start: i, out: append(f1.out, f2.out...)}
+}
+
+// quest matches f zero or one times, preferring one if greedy
+func (c *compiler) quest(f frag, greedy bool) frag {
+	i := c.emit(inst{op: instAlt})
+	if greedy {
+		c.p.insts[i].out = f.start
+		return frag{start: i, out: append(f.out, patch{i: i, arg: true})}
+	}
+	c.p.insts[i].arg = f.start
+	return frag{start: i, out: append(f.out, patch{i: i})}
+}
+
+// star matches f zero or more times, preferring more if greedy
+func (c *compiler) star(f frag, greedy bool) frag {
+	i := c.emit(inst{op: instAlt})
+	c.patch(f.out, i)
+	if greedy {
+		c.p.insts[i].out = f.start
+		return frag{start: i, out: []patch{{i: i, arg: true}}}
+	}
+	c.p.insts[i].arg = f.start
+	return frag{start: i, out: []patch{{i: i}}}
+}
+
+// plus matches f one or more times, preferring more if greedy
+func (c *compiler) plus(f frag, greedy bool) frag {
+	loop := c.star(f, greedy)
+	return frag{start: f.start, out: loop.out}
+}
+
+// progress guards f, which is the body of a loop that can match the empty string
+func (c *compiler) progress(f frag) frag {
+	i := c.emit(inst{op: instProgress, arg: c.p.numLoops, out: f.start})
+	c.p.numLoops++
+	return frag{start: i, out: f.out}
+}
+
+// node compiles n and everything that follows it
+func (c *compiler) node(n *node) frag {
+	if n == nil {
+		return c.nop()
+	}
+
+	f := c.repeat(n)
+	if n.next != nil && c.reverse {
+		f = c.cat(c.node(n.next), f)
+	} else if n.next != nil {
+		f = c.cat(f, c.node(n.next))
+	}
+	return f
+}
+
+// repeat compiles the quantifier of n, every repetition gets its own copy of the atom
+func (c *compiler) repeat(n *node) frag {
+	if n.ma == 0 {
+		// x{0} and x{0,0} never take part in a match, but must still match the empty string
+		return c.nop()
+	}
+
+	if n.mi > n.ma {
+		return c.fail()
+	}
+
+	greedy := (n.flags&flagUngreedy == 0) != n.lazy
+
+	var f frag
+	haveF := false
+	appendFrag := func(next frag) {
+		if !haveF {
+			f = next
+			haveF = true
+			return
+		}
+		f = c.cat(f, next)
+	}
+
+	// x{n,} becomes x^(n-1)x+, or x* for n = 0
+	if n.ma == math.MaxInt {
+		for range n.mi - 1 {
+			appendFrag(c.atom(n))
+		}
+		body := c.atom(n)
+		nullableBody := atomNullable(n)
+		if nullableBody {
+			body = c.progress(body)
+		}
+		switch {
+		case n.mi == 0 && nullableBody:
+			// x* becomes (x+)?, so that an empty pass through x takes part in the match instead of being
+			// dropped for coming back to the loop at the same position. this is what Go does since issue 46123
+			appendFrag(c.quest(c.plus(body, greedy), greedy))
+		case n.mi == 0:
+			appendFrag(c.star(body, greedy))
+		default:
+			appendFrag(c.plus(body, greedy))
+		}
+		return f
+	}
+
+	// x{n,m} becomes x^n(x(x(...)?)?)?
+	for range n.mi {
+		appendFrag(c.atom(n))
+	}
+	if n.ma > n.mi {
+		var opt frag
+		for i := 0; i < n.ma-n.mi; i++ {
+			if i == 0 {
+				opt = c.quest(c.atom(n), greedy)
+			} else {
+				opt = c.quest(c.cat(c.atom(n), opt), greedy)
+			}
+		}
+		appendFrag(opt)
+	}
+	return f
+}
+
+// atom compiles the state of n, ignoring its quantifier and its successors
+func (c *compiler) atom(n *node) frag {
+	if c.err != nil {
+		// the program is thrown away, don't spend any more time on it
+		return c.nop()
+	}
+	switch s := n.state.(type) {
+	case *charState:
+		if n.flags&flagFoldCase != 0 {
+			if ranges := foldCharRanges([]charRange{{from: s.char, to: s.char}}); len(ranges) > 1 {
+				i := c.emit(inst{op: instBracket, ranges: ranges})
+				return frag{start: i, out: []patch{{i: i}}}
+			}
+		}
+		i := c.emit(inst{op: instChar, char: s.char})
+		return frag{start: i, out: []patch{{i: i}}}
+	case *bracketState:
+		ranges := s.ranges
+		if n.flags&flagFoldCase != 0 {
+			ranges = foldCharRanges(ranges)
+		}
+		i := c.emit(inst{op: instBracket, negate: s.negate, ranges: ranges})
+		return frag{start: i, out: []patch{{i: i}}}
+	case *flagState:
+		return c.nop()
+	case *assertState:
+		return c.empty(s.op)
+	case *lookState:
+		sub := compiler{p: &prog{numCap: c.p.numCap, names: c.p.names}}
+		f := sub.node(s.firstChild)
+		sub.patch(f.out, sub.emit(inst{op: instMatch}))
+		sub.p.start = f.start
+		if sub.err == nil && sub.p.backrefs {
+			sub.err = fmt.Errorf("backreferences are not supported inside of look-around assertions")
+		}
+		if c.err == nil {
+			c.err = sub.err
+		}
+
+		c.p.looks = append(c.p.looks, &look{
+			prog:   sub.p,
+			behind: s.behind,
+			negate: s.negate,
+			minLen: s.minLen,
+			maxLen: s.maxLen,
+		})
+		i := c.emit(inst{op: instLook, arg: len(c.p.looks) - 1})
+		return frag{start: i, out: []patch{{i: i}}}
+	case *backrefState:
+		index := s.index
+		if s.name != "" {
+			index = slices.Index(c.p.names, s.name)
+		}
+		if index <= 0 || index >= len(c.p.names) {
+			if c.err == nil && s.name != "" {
+				c.err = fmt.Errorf("backreference to unknown group %q", s.name)
+			} else if c.err == nil {
+				c.err = fmt.Errorf("backreference to unknown group %d", s.index)
+			}
+			return c.fail()
+		}
+		c.p.backrefs = true
+		i := c.emit(inst{op: instBackref, arg: index, fold: n.flags&flagFoldCase != 0})
+		return frag{start: i, out: []patch{{i: i}}}
+	case *choiceState:
+		f := c.node(s.choices[len(s.choices)-1])
+		for i := len(s.choices) - 2; i >= 0; i-- {
+			f = c.alt(c.node(s.choices[i]), f)
+		}
+		return f
+	case *groupState:
+		if !s.capture {
+			return c.node(s.firstChild)
+		}
+		f := c.save(2 * s.index)
+		f = c.cat(f, c.node(s.firstChild))
+		return c.cat(f, c.save(2*s.index+1))
+	}
+	panic("unexpected `state` type")
+}
+
+// nullable reports whether n and all of its successors can match the empty string
+func nullable(n *node) bool {
+	for ; n != nil; n = n.next {
+		if n.mi > 0 && !atomNullable(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// atomNullable reports whether the state of n, ignoring its quantifier, can match the empty string
+func atomNullable(n *node) bool {
+	switch s := n.state.(type) {
+	case *charState, *bracketState:
+		return false
+	case *choiceState:
+		return slices.ContainsFunc(s.choices, nullable)
+	case *groupState:
+		return nullable(s.firstChild)
+	}
+	// a backreference can refer to an empty capture
+	return true
+}
+
+// reachWidth returns the maximum number of runes after its start that matching n and its successors can examine.
+// this is the maximum of runeWidth, except that look-around assertions count as wide as their contents
+func reachWidth(n *node) int {
+	ma := 0
+	for ; n != nil; n = n.next {
+		atomMa := 0
+		switch s := n.state.(type) {
+		case *charState, *bracketState:
+			atomMa = 1
+		case *groupState:
+			atomMa = reachWidth(s.firstChild)
+		case *lookState:
+			atomMa = reachWidth(s.firstChild)
+		case *choiceState:
+			for _, c := range s.choices {
+				atomMa = max(atomMa, reachWidth(c))
+			}
+		case *backrefState:
+			atomMa = math.MaxInt
+		}
+		ma = saturatingAdd(ma, saturatingMul(atomMa, n.ma))
+	}
+	return ma
+}
+
+// behindWidth returns the maximum number of runes before its start that matching n and its successors can examine
+func behindWidth(n *node) int {
+	ma := 0
+	for ; n != nil; n = n.next {
+		switch s := n.state.(type) {
+		case *groupState:
+			ma = max(ma, behindWidth(s.firstChild))
+		case *lookState:
+			width := behindWidth(s.firstChild)
+			if s.behind {
+				width = saturatingAdd(width, s.maxLen)
+			}
+			ma = max(ma, width)
+		case *choiceState:
+			for _, c := range s.choices {
+				ma = max(ma, behindWidth(c))
+			}
+		}
+	}
+	return ma
+}
+
+// runes outside of this range are their own case folding
+const (
+	minFold = 0x0041
+	maxFold = 0x1e943
+)
+
+// foldCharRanges adds all case variants of the runes in ranges, e.g. [a-c] becomes [a-cA-C]
+func foldCharRanges(ranges []charRange) []charRange {
+	folded := slices.Clone(ranges)
+	for _, r := range ranges {
+		// a range covering all runes affected by case folding already contains all of its variants
+		if r.from <= minFold && r.to >= maxFold {
+			continue
+		}
+		for c := max(r.from, minFold); c <= min(r.to, maxFold); c++ {
+			for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+				folded = append(folded, charRange{from: f, to: f})
+			}
+		}
+	}
+	return normalizeCharRanges(folded)
+}
@@ -0,0 +1,25 @@
+package regex
+
+import (
+	"io"
+)
+
+// MatchReader reports whether the text read from r contains a match of the pattern.
+// only as much of r is read as needed to decide
+func (re Regex) MatchReader(r io.RuneReader) bool {
+	return re.FindReaderIndex(r) != nil
+}
+
+// FindReaderIndex returns the start and end offset of the leftmost match in the text read from r, or nil if there is none.
+// the offsets are in bytes, as reported by r. r may be read beyond the end of the match.
+// patterns with backreferences or look-around keep everything read from r in memory, all other patterns only
+// keep the most recently read runes
+func (re Regex) FindReaderIndex(r io.RuneReader) []int {
+	in := newInputReader(r, re.prog.backrefs || len(re.prog.looks) > 0)
+	m := re.getMachine()
+	defer re.putMachine(m)
+	if !m.match(in, 0) {
+		return nil
+	}
+	return []int{m.matchcap[0], m.matchcap[1]}
+}
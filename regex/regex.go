@@ -1,21 +1,20 @@
 package regex
 
-// missing and I want to add:
-// potentially: proper multiline support (right now, no guarantee that it works as intended)
-// potentially: unicode support
-// potentially: more than just ERE support, e.g. non-greedy (lazy) quantifier variants like .+?
-// potentially: look ahead/look behind
-
 import (
 	"fmt"
-	"strings"
-	"unicode"
+	"slices"
+	"sync"
 )
 
+// Regex is a compiled pattern.
+// It is immutable and can be shared between goroutines, all match state lives in machines taken from a pool
 type Regex struct {
-	root        *node
-	strictStart bool
-	strictEnd   bool
+	// the pattern as passed to Compile
+	expr     string
+	prog     *prog
+	machines *sync.Pool
+	// limits every search, see WithBudget
+	budget Budget
 }
 
 type Submatch struct {
@@ -23,62 +22,184 @@ type Submatch struct {
 	Str    string
 }
 
-func Compile(re string) (Regex, error) {
-	strictStart := false
-	if len(re) > 0 && re[0] == '^' {
-		strictStart = true
-		re = re[1:]
-	}
-
-	strictEnd := false
-	if len(re) > 0 && re[len(re)-1] == '$' {
-		strictEnd = true
-		re = re[:len(re)-1]
+func Compile(expr string) (Regex, error) {
+	re := "(" + expr + ")"
+	root, err := parseGroup(re, 0, 0)
+	if err != nil {
+		return Regex{}, fmt.Errorf("failed to construct regex from %q: %w", re, err)
 	}
-
-	re = "(" + re + ")"
-	root, err := parseGroup(re, 0)
+	p, err := compileProg(root)
 	if err != nil {
 		return Regex{}, fmt.Errorf("failed to construct regex from %q: %w", re, err)
 	}
+
+	seen := make(map[string]bool)
+	for _, name := range p.names {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return Regex{}, fmt.Errorf("failed to construct regex from %q: duplicate group name %q", re, name)
+		}
+		seen[name] = true
+	}
+
 	return Regex{
-		root:        root,
-		strictStart: strictStart,
-		strictEnd:   strictEnd,
+		expr: expr,
+		prog: p,
+		machines: &sync.Pool{
+			New: func() any { return newMachine(p) },
+		},
 	}, nil
 }
 
+// NumSubexp returns the number of capture groups in the pattern, not counting the implicit group 0
+func (re Regex) NumSubexp() int {
+	return len(re.prog.names) - 1
+}
+
+// SubexpNames returns the names of the capture groups, indexed like the submatches.
+// Unnamed groups, including the implicit group 0, have the name ""
+func (re Regex) SubexpNames() []string {
+	return slices.Clone(re.prog.names)
+}
+
+// SubexpIndex returns the index of the capture group with the given name, or -1 if there is none
+func (re Regex) SubexpIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	return slices.Index(re.prog.names, name)
+}
+
+func (re Regex) getMachine() *machine {
+	m := re.machines.Get().(*machine)
+	m.startBudget(re.budget)
+	return m
+}
+
+func (re Regex) putMachine(m *machine) {
+	m.ctx = nil
+	re.machines.Put(m)
+}
+
 // FindAllSubmatches finds up to maxCount submatches of the pattern in the given string
 // To return all submatches pass a maxCount of -1
+// Groups that did not take part in a match are reported with an Offset of -1
 func (re Regex) FindAllSubmatches(s string, maxCount int) [][]Submatch {
 	var allSubmatches [][]Submatch
-	for i := 0; i < len(s); i += 1 {
-		if maxCount != -1 && len(allSubmatches) >= maxCount {
-			return allSubmatches
-		}
-		if re.strictStart && (i != 0 && (s[i-1] != '\n')) {
-			continue
+	re.allMatches(inputString(s), len(s), maxCount, func(caps []int) {
+		allSubmatches = append(allSubmatches, submatchesOf(s, caps))
+	})
+	return allSubmatches
+}
+
+// FindIndex returns the start and end offset of the leftmost match in s, or nil if there is none
+func (re Regex) FindIndex(s string) []int {
+	all := re.FindAllIndex(s, 1)
+	if len(all) < 1 {
+		return nil
+	}
+	return all[0]
+}
+
+// FindAllIndex returns the start and end offsets of up to maxCount matches in s, pass -1 to return all of them
+func (re Regex) FindAllIndex(s string, maxCount int) [][]int {
+	var all [][]int
+	re.allIndexes(inputString(s), len(s), maxCount, func(caps []int) {
+		all = append(all, []int{caps[0], caps[1]})
+	})
+	return all
+}
+
+// FindSubmatchIndex returns the offsets of the leftmost match and its groups in s, or nil if there is none.
+// the start and end of group i are at index 2*i and 2*i+1, both are -1 if the group did not take part in the match
+func (re Regex) FindSubmatchIndex(s string) []int {
+	all := re.FindAllSubmatchIndex(s, 1)
+	if len(all) < 1 {
+		return nil
+	}
+	return all[0]
+}
+
+// FindAllSubmatchIndex returns the offsets of up to maxCount matches and their groups in s, pass -1 to return all of them.
+// each match is laid out like the result of FindSubmatchIndex
+func (re Regex) FindAllSubmatchIndex(s string, maxCount int) [][]int {
+	var all [][]int
+	re.allMatches(inputString(s), len(s), maxCount, func(caps []int) {
+		all = append(all, slices.Clone(caps))
+	})
+	return all
+}
+
+// allMatches calls deliver with the capture slots of up to maxCount successive, non-overlapping matches in the
+// first length bytes of in. caps is only valid until deliver returns
+func (re Regex) allMatches(in input, length int, maxCount int, deliver func(caps []int)) {
+	re.eachMatch(in, length, maxCount, true, func(caps []int) bool {
+		deliver(caps)
+		return true
+	})
+}
+
+// allIndexes is like allMatches, but only the start and end of the matches in caps[0] and caps[1] are valid.
+// this allows finding them with the DFAs, which is a lot faster than tracking the groups
+func (re Regex) allIndexes(in input, length int, maxCount int, deliver func(caps []int)) {
+	re.eachMatch(in, length, maxCount, false, func(caps []int) bool {
+		deliver(caps)
+		return true
+	})
+}
+
+// eachMatch is like allMatches, but stops searching as soon as yield returns false.
+// if captures isn't set, only the start and end of the matches are computed
+func (re Regex) eachMatch(in input, length int, maxCount int, captures bool, yield func(caps []int) bool) {
+	m := re.getMachine()
+	defer re.putMachine(m)
+	find := m.match
+	if !captures {
+		find = m.matchIndex
+	}
+	prevMatchEnd := -1
+	for pos, n := 0, 0; pos <= length && (maxCount == -1 || n < maxCount); {
+		if !find(in, pos) {
+			break
 		}
 
-		_, match := re.root.match(s[i:], 0, 0)
-		var submatches []Submatch
-		re.root.collectSubmatches(s[i:], &submatches)
-		if match {
-			for j := range submatches {
-				submatches[j].Offset += i
+		accept := true
+		start, end := m.matchcap[0], m.matchcap[1]
+		if end == start {
+			// empty matches directly after a previous match are ignored
+			if start == prevMatchEnd {
+				accept = false
 			}
-			rootMatchStr := submatches[0].Str
-			if !re.strictEnd ||
-				// end of input string
-				len(rootMatchStr) == len(s[i:]) ||
-				// newline right after
-				(len(rootMatchStr)+1 < len(s) && s[len(rootMatchStr)+1] == '\n') {
-				allSubmatches = append(allSubmatches, submatches)
-				i += len(rootMatchStr) - 1
+			// move on to the next rune
+			_, w := in.step(end)
+			pos = end + max(w, 1)
+		} else {
+			pos = end
+		}
+		prevMatchEnd = end
+
+		if accept {
+			if !yield(m.matchcap) {
+				return
 			}
+			n++
 		}
 	}
-	return allSubmatches
+}
+
+func submatchesOf(s string, caps []int) []Submatch {
+	submatches := make([]Submatch, len(caps)/2)
+	for i := range submatches {
+		from, to := caps[2*i], caps[2*i+1]
+		if from < 0 || to < 0 {
+			submatches[i] = Submatch{Offset: -1}
+			continue
+		}
+		submatches[i] = Submatch{Offset: from, Str: s[from:to]}
+	}
+	return submatches
 }
 
 func (re Regex) FindSubmatch(s string) []Submatch {
@@ -89,28 +210,9 @@ func (re Regex) FindSubmatch(s string) []Submatch {
 	return submatch[0]
 }
 
+// Match reports whether s contains a match of the pattern
 func (re Regex) Match(s string) bool {
-	return len(re.FindSubmatch(s)) > 0
-}
-
-func (re Regex) Replace(s string, with string) string {
-	submatches := re.FindSubmatch(s)
-	out := strings.Builder{}
-	for i := 0; i < len(with); i++ {
-		if with[i] == '$' && i+1 < len(with) && unicode.IsDigit(rune(with[i+1])) {
-			num := 0
-			for j := i + 1; j < len(with) && unicode.IsDigit(rune(with[j])); j++ {
-				num *= 10
-				num += int(with[j] - '0')
-				i++
-			}
-
-			if num < len(submatches) {
-				out.WriteString(submatches[num].Str)
-			}
-		} else {
-			out.WriteByte(with[i])
-		}
-	}
-	return out.String()
+	m := re.getMachine()
+	defer re.putMachine(m)
+	return m.matches(inputString(s), 0)
 }
@@ -1,8 +1,18 @@
 package regex
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -122,8 +132,8 @@ func TestFindSubmatch(t *testing.T) {
 		"ere_tricky_literal_dot": {
 			givenRe: `([.]|[a-z])\.?`,
 			givenStrings: []string{
-				//".",
-				//"a",
+				".",
+				"a",
 				"a.",
 				"..",
 				"z.",
@@ -288,17 +298,193 @@ func TestFindSubmatch(t *testing.T) {
 			givenRe:      `[\r\f\t\n]`,
 			givenStrings: []string{"\t\n\r\f"},
 		},
+		// unicode
+		"unicode_dot_matches_whole_rune": {
+			givenRe:      `h(.)llo`,
+			givenStrings: []string{"héllo", "h😀llo", "hello"},
+		},
+		"unicode_literal_in_bracket": {
+			givenRe:      `caf[éè]+`,
+			givenStrings: []string{"café", "cafèé", "cafe"},
+		},
+		"unicode_range": {
+			givenRe:      `([α-ω]+) ([^α-ω]+)`,
+			givenStrings: []string{"abc αβγ def", "λόγος logos"},
+		},
+		"unicode_negated_perl_char_set": {
+			givenRe:      `\W+`,
+			givenStrings: []string{"ü ö", "日本"},
+		},
+		"unicode_quantified_literal": {
+			givenRe:      `ü{2}`,
+			givenStrings: []string{"üüü", "ü"},
+		},
+		"unicode_property_class": {
+			givenRe:      `(\p{Greek}+) (\pL+) (\pN+)`,
+			givenStrings: []string{"λόγος über ٣٤", "abc def 12"},
+		},
+		"unicode_negated_property_class": {
+			givenRe:      `\PL+|\P{^N}+`,
+			givenStrings: []string{"éa 12 b", "٣x", "日本"},
+		},
+		"unicode_property_class_in_bracket": {
+			givenRe:      `[\p{Lu}\d_]+ [^\p{L}\s]+ [\P{Latin}]+`,
+			givenStrings: []string{"ÄÖ_9 !?12 日本", "AB x Ü"},
+		},
+		"unicode_script_vs_posix_alpha": {
+			givenRe:      `[[:alpha:]]+|\p{Han}+`,
+			givenStrings: []string{"日本語 text", "text 日本語"},
+		},
+		// flags
+		"flags_case_insensitive_with_scoped_case_sensitive": {
+			givenRe:      `(?i)error|(?-i:WARN)`,
+			givenStrings: []string{"ERROR", "an Error: x", "warn WARN", "WaRN"},
+		},
+		"flags_case_insensitive_bracket": {
+			givenRe:      `(?i)[a-cé]+`,
+			givenStrings: []string{"xABcÉé", "Ü"},
+		},
+		"flags_case_insensitive_negated_bracket": {
+			givenRe:      `(?i)[^a]+`,
+			givenStrings: []string{"AaBb", "bAB"},
+		},
+		"flags_case_insensitive_unicode_folding": {
+			givenRe:      `(?i)k+ß`,
+			givenStrings: []string{"Kk\u212aß", "kẞ"},
+		},
+		"flags_in_the_middle_of_a_group": {
+			givenRe:      `(a(?i)b|c)`,
+			givenStrings: []string{"aB", "C", "AB"},
+		},
+		"flags_scoped_group_does_not_capture": {
+			givenRe:      `(?i:a+)(b)`,
+			givenStrings: []string{"AaB", "Aab"},
+		},
+		"flags_dot_matches_newline": {
+			givenRe:      `(?s)a(.)b|x.y`,
+			givenStrings: []string{"a\nb", "x\ny"},
+		},
+		"flags_dot_does_not_match_newline": {
+			givenRe:      `a.b`,
+			givenStrings: []string{"a\nb", "a b"},
+		},
+		"flags_ungreedy": {
+			givenRe:      `(?U)(a+)(a*)`,
+			givenStrings: []string{"aaa"},
+		},
+		"flags_ungreedy_scoped": {
+			givenRe:      `(?U:(a+))(a*)(?sU)(.+)`,
+			givenStrings: []string{"aaa\nbb"},
+		},
+		"flags_clear_multiple": {
+			givenRe:      `(?is)a(?-is:b.)c`,
+			givenStrings: []string{"Ab.C", "AB.C", "Ab\nC"},
+		},
+		"flags_multi_line_anchors": {
+			givenRe:      `(?m)^b+$`,
+			givenStrings: []string{"a\nbb\nc", "bb"},
+		},
+		"flags_text_anchors": {
+			givenRe:      `^b+$`,
+			givenStrings: []string{"a\nbb\nc", "bb"},
+		},
+		// lazy quantifiers
+		"lazy_star": {
+			givenRe:      `"(.*?)"`,
+			givenStrings: []string{`say "hi" and "bye"`, `""`},
+		},
+		"lazy_plus": {
+			givenRe:      `(a+?)(a*)`,
+			givenStrings: []string{"aaaa"},
+		},
+		"lazy_quest": {
+			givenRe:      `(a??)(a?)b`,
+			givenStrings: []string{"ab", "aab", "b"},
+		},
+		"lazy_range": {
+			givenRe:      `(\d{2,4}?)(\d*)`,
+			givenStrings: []string{"123456", "12"},
+		},
+		"lazy_exact_count": {
+			givenRe:      `(x{2}?)(x*)`,
+			givenStrings: []string{"xxxx"},
+		},
+		"lazy_group": {
+			givenRe:      `((ab)+?)(ab|c)*`,
+			givenStrings: []string{"abababc"},
+		},
+		"lazy_inverted_by_ungreedy_flag": {
+			givenRe:      `(?U)(a+?)(a+)`,
+			givenStrings: []string{"aaaa"},
+		},
+		// groups
+		"non_capturing_group": {
+			givenRe:      `(?:ab|cd)+(e)`,
+			givenStrings: []string{"abcde", "cdabe"},
+		},
+		"named_groups": {
+			givenRe:      `(?P<year>\d{4})-(?<month>\d{2})(?:-(?P<day>\d{2}))?`,
+			givenStrings: []string{"2024-05-17", "2024-05"},
+		},
+		// anchors
+		"anchors_inside_group": {
+			givenRe:      `(^a|b$)`,
+			givenStrings: []string{"ab", "cb", "ca"},
+		},
+		"anchors_inside_choices": {
+			givenRe:      `foo|^bar`,
+			givenStrings: []string{"bar foo", "x bar foo", "x bar"},
+		},
+		"anchors_text": {
+			givenRe:      `\Aab|cd\z`,
+			givenStrings: []string{"abcd", "xabcd", "cdx"},
+		},
+		"anchors_word_boundary": {
+			givenRe:      `\bcat\b`,
+			givenStrings: []string{"concat cat", "cats", "a cat."},
+		},
+		"anchors_no_word_boundary": {
+			givenRe:      `\Bcat\w*`,
+			givenStrings: []string{"cat concatenate", "cat"},
+		},
+		"anchors_never_match": {
+			givenRe:      `a^b|x$y`,
+			givenStrings: []string{"ab", "a^b", "xy"},
+		},
+		"anchors_escaped_dollar": {
+			givenRe:      `(\d+)\$$`,
+			givenStrings: []string{"costs 10$", "10$ more"},
+		},
 		"yaya": {
 			givenRe: `func\s+(.)+(\{)`,
 			givenStrings: []string{
 				"func recursivelySearchDir(path string, re *regex.Regex) error{",
 			},
 		},
-		// todo: '(+)' is overly greedy :/ (we can't backtrack from within the capture group, thus the capture group will match as much as possible :(, will require full redesign)
-		// "yoyo": {
-		// 	givenRe:      `^(fn|func)\s+(\w+)(\(.+\))\s+(->)?\s+([[:ascii:]]+)\s+\{$`,
-		// 	givenStrings: []string{"fn search(haystack: &str, needle: &str) -> Option<usize> {"},
-		// },
+		"yoyo": {
+			givenRe:      `^(fn|func)\s+(\w+)(\(.+\))\s+(->)?\s+([[:ascii:]]+)\s+\{$`,
+			givenStrings: []string{"fn search(haystack: &str, needle: &str) -> Option<usize> {"},
+		},
+		"backtrack into capture group": {
+			givenRe:      `([a-z[:ascii:]]+)\s+`,
+			givenStrings: []string{"something ", "some thing  "},
+		},
+		"lazy loop body inside of star": {
+			givenRe:      `(?:a*?)*`,
+			givenStrings: []string{"aab", "", "b"},
+		},
+		"lazy optional inside of plus": {
+			givenRe:      `(a??)+`,
+			givenStrings: []string{"aab", "", "b"},
+		},
+		"capturing lazy loop body inside of star": {
+			givenRe:      `(a*?)*`,
+			givenStrings: []string{"aab", "", "b"},
+		},
+		"lazy loops with assertions": {
+			givenRe:      `\B(?:\w+(b??)*^\w{1,2}|\w*){1,2}?(\W*?)*`,
+			givenStrings: []string{"\nc", "ab\nc"},
+		},
 	}
 
 	for name, tt := range tests {
@@ -343,24 +529,18 @@ func TestFindSubmatch(t *testing.T) {
 	}
 }
 
-func TestReplace(t *testing.T) {
+func TestFindAllSubmatchesOffsets(t *testing.T) {
 	tests := map[string]struct {
-		givenRe      string
-		givenStr     string
-		givenReplace string
-		wantReplaced string
+		givenRe     string
+		givenString string
 	}{
-		"complex, many replace": {
-			givenRe:      `[0-9]{2}:[0-9]{2}:[0-9]{2}(_WARN|_INFO|_ERROR)? ([A-Za-z ]+)?(\[ID:[0-9]+\]|\[MSG:[^\]]+\])?`,
-			givenStr:     "01:02:03_ERROR Critical Error [ID:999]",
-			givenReplace: "I$3reversed$2them$1hihi$0",
-			wantReplaced: "I" + "[ID:999]" + "reversed" + "Critical Error " + "them" + "_ERROR" + "hihi" + "01:02:03_ERROR Critical Error [ID:999]",
+		"offsets are byte offsets": {
+			givenRe:     `(ö+)(\w)?`,
+			givenString: `aöö bö cööx`,
 		},
-		"complex, replace with empty string if group not matched": {
-			givenRe:      `(aa)b?`,
-			givenStr:     "aab",
-			givenReplace: "$0$2",
-			wantReplaced: "aab",
+		"optional group does not take part": {
+			givenRe:     `(a)|(日)`,
+			givenString: `日a本日`,
 		},
 	}
 
@@ -371,51 +551,61 @@ func TestReplace(t *testing.T) {
 			if gotErr != nil {
 				t.Fatalf("our Compile: %v", gotErr)
 			}
-			gotReplaced := re.Replace(tt.givenStr, tt.givenReplace)
+			var gotOffsets [][]int
+			for _, match := range re.FindAllSubmatches(tt.givenString, -1) {
+				var offsets []int
+				for _, sm := range match {
+					if sm.Offset < 0 {
+						offsets = append(offsets, -1, -1)
+						continue
+					}
+					offsets = append(offsets, sm.Offset, sm.Offset+len(sm.Str))
+				}
+				gotOffsets = append(gotOffsets, offsets)
+			}
+
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+			wantOffsets := goRe.FindAllStringSubmatchIndex(tt.givenString, -1)
 
 			// then
-			if d := cmp.Diff(tt.wantReplaced, gotReplaced); d != "" {
+			if d := cmp.Diff(wantOffsets, gotOffsets); d != "" {
 				t.Errorf("got diff (-want +got):\n%s", d)
 			}
 		})
 	}
 }
 
-func TestFindAllSubmatches(t *testing.T) {
+func TestFindIndex(t *testing.T) {
 	tests := map[string]struct {
-		givenRe        string
-		givenString    string
-		wantSubmatches [][]Submatch
+		givenRe     string
+		givenString string
 	}{
-
-		"happy bananas": {
-			givenRe:     "ba(.{0,2})na",
-			givenString: "anbananaortwobananasbaxana",
+		"no match": {
+			givenRe:     `x+`,
+			givenString: "abc",
 		},
-		"multiline - dotall and groups": {
-			givenRe: `BEGIN\n(.*)\nEND`,
-			givenString: `Some preamble
-BEGIN
-  Line 1 of content
-  Line 2 of content
-END
-Some postamble`,
+		"optional groups that don't take part": {
+			givenRe:     `(a)?(b)?c`,
+			givenString: "abc ac bc c",
 		},
-		"nested groups - json like structure": {
-			givenRe:     `\{\s*"id":\s*(\d+),\s*"data":\s*"([^"]*)"\s*\}`,
-			givenString: `Before {"id": 123, "data": "hello"} after {"id": 456, "data": "world"} end`,
+		"empty group that takes part": {
+			givenRe:     `(a*)(b)`,
+			givenString: "b ab",
 		},
-		//"nested groups - path segments": {
-		//	givenRe:     `(/(\w+))+`,
-		//	givenString: `/usr/local/bin/my_app /var/log/app.log`,
-		//},
-		"complex nested groups with different character sets": {
-			givenRe:     `\[(\w+):(<([^>]+)>)?\]`,
-			givenString: `[Config: <Setting1>] [Type: <Boolean>] [Name: ]`,
+		"nested groups": {
+			givenRe:     `((\w)(\w*))@((\w+)\.(com|org))`,
+			givenString: "mail a@b.com or xy@z.org",
 		},
-		"capture empty groups": {
-			givenRe:     `(a)?(b)?c`,
-			givenString: `abc ac bc c`,
+		"empty matches": {
+			givenRe:     `(x)*`,
+			givenString: "axxbx",
+		},
+		"unicode": {
+			givenRe:     `(é)|(ü+)`,
+			givenString: "aéüüb",
 		},
 	}
 
@@ -426,27 +616,1939 @@ Some postamble`,
 			if gotErr != nil {
 				t.Fatalf("our Compile: %v", gotErr)
 			}
-			gotSubmatches := re.FindAllSubmatches(tt.givenString, -1)
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
 
-			var gotSubmatchesStrings [][]string
-			for _, match := range gotSubmatches {
-				var submatchStrings []string
-				for _, sm := range match {
-					submatchStrings = append(submatchStrings, sm.Str)
-				}
-				gotSubmatchesStrings = append(gotSubmatchesStrings, submatchStrings)
+			// then
+			if d := cmp.Diff(goRe.FindStringIndex(tt.givenString), re.FindIndex(tt.givenString)); d != "" {
+				t.Errorf("FindIndex: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllStringIndex(tt.givenString, -1), re.FindAllIndex(tt.givenString, -1)); d != "" {
+				t.Errorf("FindAllIndex: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllStringIndex(tt.givenString, 1), re.FindAllIndex(tt.givenString, 1)); d != "" {
+				t.Errorf("FindAllIndex with maxCount: got diff (-want +got):\n%s", d)
 			}
+			if d := cmp.Diff(goRe.FindStringSubmatchIndex(tt.givenString), re.FindSubmatchIndex(tt.givenString)); d != "" {
+				t.Errorf("FindSubmatchIndex: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(tt.givenString, -1), re.FindAllSubmatchIndex(tt.givenString, -1)); d != "" {
+				t.Errorf("FindAllSubmatchIndex: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+// patterns which golang's regexp doesn't accept, so we have to spell out the expected submatches
+func TestBytesAndReader(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+	}{
+		"no match": {
+			givenRe:     `x+`,
+			givenString: "abc",
+		},
+		"optional groups that don't take part": {
+			givenRe:     `(a)?(b)?c`,
+			givenString: "abc ac bc c",
+		},
+		"empty matches": {
+			givenRe:     `(x)*`,
+			givenString: "axxbx",
+		},
+		"unicode": {
+			givenRe:     `(é)|(ü+)`,
+			givenString: "aéüüb",
+		},
+		"anchors and word boundaries": {
+			givenRe:     `(?m)^\w+\b|\b\w+$`,
+			givenString: "ab cd\nef gh",
+		},
+		"leftmost-first": {
+			givenRe:     `a+?b|a+`,
+			givenString: "xaaab",
+		},
+	}
 
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
 			goRe, err := regexp.Compile(tt.givenRe)
 			if err != nil {
 				t.Fatalf("golang Compile: %v", err)
 			}
-			wantMatchesStrings := goRe.FindAllStringSubmatch(tt.givenString, -1)
+			b := []byte(tt.givenString)
 
 			// then
-			if d := cmp.Diff(wantMatchesStrings, gotSubmatchesStrings); d != "" {
+			if want, got := goRe.Match(b), re.MatchBytes(b); want != got {
+				t.Errorf("MatchBytes: want %v, got %v", want, got)
+			}
+			if d := cmp.Diff(goRe.Find(b), re.FindBytes(b)); d != "" {
+				t.Errorf("FindBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAll(b, -1), re.FindAllBytes(b, -1)); d != "" {
+				t.Errorf("FindAllBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindIndex(b), re.FindIndexBytes(b)); d != "" {
+				t.Errorf("FindIndexBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllIndex(b, 1), re.FindAllIndexBytes(b, 1)); d != "" {
+				t.Errorf("FindAllIndexBytes with maxCount: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindSubmatch(b), re.FindSubmatchBytes(b)); d != "" {
+				t.Errorf("FindSubmatchBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllSubmatch(b, -1), re.FindAllSubmatchesBytes(b, -1)); d != "" {
+				t.Errorf("FindAllSubmatchesBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindSubmatchIndex(b), re.FindSubmatchIndexBytes(b)); d != "" {
+				t.Errorf("FindSubmatchIndexBytes: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllSubmatchIndex(b, -1), re.FindAllSubmatchIndexBytes(b, -1)); d != "" {
+				t.Errorf("FindAllSubmatchIndexBytes: got diff (-want +got):\n%s", d)
+			}
+			if want, got := goRe.MatchReader(strings.NewReader(tt.givenString)), re.MatchReader(strings.NewReader(tt.givenString)); want != got {
+				t.Errorf("MatchReader: want %v, got %v", want, got)
+			}
+			if d := cmp.Diff(goRe.FindReaderIndex(strings.NewReader(tt.givenString)), re.FindReaderIndex(strings.NewReader(tt.givenString))); d != "" {
+				t.Errorf("FindReaderIndex: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestFindReaderIndexWithoutReference(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+		want        []int
+	}{
+		"backreference": {
+			givenRe:     `(\w)\1`,
+			givenString: "abccd",
+			want:        []int{2, 4},
+		},
+		"lookbehind": {
+			givenRe:     `(?<=é)\w`,
+			givenString: "aébéc",
+			want:        []int{3, 4},
+		},
+		"lookahead": {
+			givenRe:     `\w+(?=!)`,
+			givenString: "ab cd!",
+			want:        []int{3, 5},
+		},
+		"no match": {
+			givenRe:     `(a)\1`,
+			givenString: "abab",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+
+			// then
+			if d := cmp.Diff(tt.want, re.FindReaderIndex(strings.NewReader(tt.givenString))); d != "" {
+				t.Errorf("FindReaderIndex: got diff (-want +got):\n%s", d)
+			}
+			if want, got := tt.want != nil, re.MatchReader(strings.NewReader(tt.givenString)); want != got {
+				t.Errorf("MatchReader: want %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFindSubmatchWithoutReference(t *testing.T) {
+	tests := map[string]struct {
+		givenRe        string
+		givenString    string
+		wantSubmatches []string
+	}{
+		"backtrack into capture group (known failure of the old engine)": {
+			givenRe:        `([a-Z[:ascii:]]+)\s+`,
+			givenString:    "something ",
+			wantSubmatches: []string{"something ", "something"},
+		},
+		// backreferences
+		"backreference repeated word": {
+			givenRe:        `(\w+) \1`,
+			givenString:    "the cat cat sat",
+			wantSubmatches: []string{"cat cat", "cat"},
+		},
+		"backreference with quantifier": {
+			givenRe:        `(ab)\1{2}`,
+			givenString:    "ababxababab",
+			wantSubmatches: []string{"ababab", "ab"},
+		},
+		"named backreference": {
+			givenRe:        `(?P<quote>['"]).*?\k<quote>`,
+			givenString:    `say "it's" ok`,
+			wantSubmatches: []string{`"it's"`, `"`},
+		},
+		"case-insensitive backreference": {
+			givenRe:        `(?i)(a+)\1`,
+			givenString:    "xaAAa",
+			wantSubmatches: []string{"aAAa", "aA"},
+		},
+		"backreference to group that did not take part": {
+			givenRe:        `(a)?\1b`,
+			givenString:    "b",
+			wantSubmatches: nil,
+		},
+		"backreference requires backtracking into the group": {
+			givenRe:        `^(a+)\1$`,
+			givenString:    "aaaa",
+			wantSubmatches: []string{"aaaa", "aa"},
+		},
+		"backreference with empty loop terminates": {
+			givenRe:        `(a*)*\1b`,
+			givenString:    "aaac",
+			wantSubmatches: nil,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			var gotSubmatches []string
+			for _, sm := range re.FindSubmatch(tt.givenString) {
+				gotSubmatches = append(gotSubmatches, sm.Str)
+			}
+
+			// then
+			if d := cmp.Diff(tt.wantSubmatches, gotSubmatches); d != "" {
 				t.Errorf("got diff (-want +got):\n%s", d)
 			}
 		})
 	}
 }
+
+func TestCompileError(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		wantMessage string
+	}{
+		"unknown unicode class": {
+			givenRe:     `\p{Klingon}`,
+			wantMessage: `unknown unicode class "Klingon"`,
+		},
+		"unknown flag": {
+			givenRe:     `(?z)a`,
+			wantMessage: `unknown group flag 'z'`,
+		},
+		"duplicate group name": {
+			givenRe:     `(?P<x>a)(?<x>b)`,
+			wantMessage: `duplicate group name "x"`,
+		},
+		"invalid group name": {
+			givenRe:     `(?P<a-b>x)`,
+			wantMessage: `invalid group name "a-b"`,
+		},
+		"backreference to unknown group": {
+			givenRe:     `(a)\2`,
+			wantMessage: `backreference to unknown group 2`,
+		},
+		"named backreference to unknown group": {
+			givenRe:     `(?P<a>x)\k<b>`,
+			wantMessage: `backreference to unknown group "b"`,
+		},
+		"unbounded lookbehind": {
+			givenRe:     `(?<=a+)b`,
+			wantMessage: `lookbehind must match a bounded number of characters`,
+		},
+		"backreference in look-around": {
+			givenRe:     `(a)(?=\1)`,
+			wantMessage: `backreferences are not supported inside of look-around assertions`,
+		},
+		"unterminated unicode class": {
+			givenRe:     `[\p{Greek]`,
+			wantMessage: `did not find closing '}'`,
+		},
+		"repeat count too large": {
+			givenRe:     `a{1001}`,
+			wantMessage: `repeat count 1001 is larger than 1000`,
+		},
+		"maximum repeat count too large": {
+			givenRe:     `a{2,1001}`,
+			wantMessage: `repeat count 1001 is larger than 1000`,
+		},
+		"nested repetitions too large": {
+			givenRe:     `(a{1000}){1000}`,
+			wantMessage: `expression too large`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			_, gotErr := Compile(tt.givenRe)
+
+			// then
+			if gotErr == nil {
+				t.Fatalf("expected error containing %q", tt.wantMessage)
+			}
+			if !strings.Contains(gotErr.Error(), tt.wantMessage) {
+				t.Errorf("got error %q, want it to contain %q", gotErr, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// patterns which golang's regexp doesn't accept, so we have to spell out the expected matches
+func TestFindAllSubmatchesWithoutReference(t *testing.T) {
+	tests := map[string]struct {
+		givenRe        string
+		givenString    string
+		wantSubmatches [][]Submatch
+	}{
+		"negative lookahead": {
+			givenRe:     `TODO(?!\(owner\))`,
+			givenString: "TODO(owner) TODO: fix",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 12, Str: "TODO"}},
+			},
+		},
+		"positive lookahead": {
+			givenRe:     `\w+(?=,)`,
+			givenString: "a, bb, c",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 0, Str: "a"}},
+				{{Offset: 3, Str: "bb"}},
+			},
+		},
+		"positive lookbehind": {
+			givenRe:     `(?<=\$)\d+`,
+			givenString: "cost 10 or $20 and $300",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 12, Str: "20"}},
+				{{Offset: 20, Str: "300"}},
+			},
+		},
+		"negative lookbehind": {
+			givenRe:     `(?<![$\d])\d+`,
+			givenString: "cost 10 or $20",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 5, Str: "10"}},
+			},
+		},
+		"lookbehind with choices of different length": {
+			givenRe:     `(?<=ab|c)x`,
+			givenString: "abx cx dx",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 2, Str: "x"}},
+				{{Offset: 5, Str: "x"}},
+			},
+		},
+		"lookbehind with multi-byte runes": {
+			givenRe:     `(?<=é{2})\w`,
+			givenString: "éa ééb",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 8, Str: "b"}},
+			},
+		},
+		"groups inside of look-around don't capture": {
+			givenRe:     `(?<=(a)b)(c)`,
+			givenString: "abc",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 2, Str: "c"}, {Offset: -1}, {Offset: 2, Str: "c"}},
+			},
+		},
+		"nested look-around": {
+			givenRe:     `a(?=b(?!c))`,
+			givenString: "abc abd",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 4, Str: "a"}},
+			},
+		},
+		"empty capture inside of a star": {
+			givenRe:     `(\b\b)*é{0,3}`,
+			givenString: "ab",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 0, Str: ""}, {Offset: 0, Str: ""}},
+				{{Offset: 1, Str: ""}, {Offset: -1}},
+				{{Offset: 2, Str: ""}, {Offset: 2, Str: ""}},
+			},
+		},
+		"empty capture inside of an anchored star": {
+			givenRe:     `^(\B)*$`,
+			givenString: "",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 0, Str: ""}, {Offset: 0, Str: ""}},
+			},
+		},
+		"look-around in backtracker": {
+			givenRe:     `(\w)\1(?=!)`,
+			givenString: "aa bb!",
+			wantSubmatches: [][]Submatch{
+				{{Offset: 3, Str: "bb"}, {Offset: 3, Str: "b"}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			gotSubmatches := re.FindAllSubmatches(tt.givenString, -1)
+
+			// then
+			if d := cmp.Diff(tt.wantSubmatches, gotSubmatches); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := map[string]struct {
+		givenRe      string
+		givenStr     string
+		givenReplace string
+		wantReplaced string
+	}{
+		"complex, many replace": {
+			givenRe:      `[0-9]{2}:[0-9]{2}:[0-9]{2}(_WARN|_INFO|_ERROR)? ([A-Za-z ]+)?(\[ID:[0-9]+\]|\[MSG:[^\]]+\])?`,
+			givenStr:     "01:02:03_ERROR Critical Error [ID:999]",
+			givenReplace: "I$3reversed$2them$1hihi$0",
+			wantReplaced: "I" + "[ID:999]" + "reversed" + "Critical Error " + "them" + "_ERROR" + "hihi" + "01:02:03_ERROR Critical Error [ID:999]",
+		},
+		"complex, replace with empty string if group not matched": {
+			givenRe:      `(aa)b?`,
+			givenStr:     "aab",
+			givenReplace: "$0$2",
+			wantReplaced: "aab",
+		},
+		"keeps the surrounding text": {
+			givenRe:      `abc`,
+			givenStr:     "xx abc yy",
+			givenReplace: "Z",
+			wantReplaced: "xx Z yy",
+		},
+		"only replaces the leftmost match": {
+			givenRe:      `(\w)(\d)`,
+			givenStr:     "a1 b2 c3",
+			givenReplace: "$2$1",
+			wantReplaced: "1a b2 c3",
+		},
+		"no match": {
+			givenRe:      `x`,
+			givenStr:     "abc",
+			givenReplace: "y",
+			wantReplaced: "abc",
+		},
+		"braces, names and dollars": {
+			givenRe:      `(?P<key>\w+)=(\w+)`,
+			givenStr:     "a=1",
+			givenReplace: "${2}0 ${key}$$ ${nope}$",
+			wantReplaced: "10 a$ $",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			gotReplaced := re.Replace(tt.givenStr, tt.givenReplace)
+
+			// then
+			if d := cmp.Diff(tt.wantReplaced, gotReplaced); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tests := map[string]struct {
+		givenRe       string
+		givenStr      string
+		givenTemplate string
+	}{
+		"no match": {
+			givenRe:       `x+`,
+			givenStr:      "abc",
+			givenTemplate: "y",
+		},
+		"numbered groups": {
+			givenRe:       `(\w+)@(\w+)\.com`,
+			givenStr:      "mail alice@example.com or bob@test.com!",
+			givenTemplate: "$2 at ${1}_x",
+		},
+		"named groups": {
+			givenRe:       `(?P<key>\w+)=(?P<value>\w*)`,
+			givenStr:      "a=1, b=, c=23",
+			givenTemplate: "${value}:${key}",
+		},
+		"groups that don't take part": {
+			givenRe:       `(a)|(b)`,
+			givenStr:      "abc",
+			givenTemplate: "[$1|$2]",
+		},
+		"references to unknown groups": {
+			givenRe:       `(a)`,
+			givenStr:      "banana",
+			givenTemplate: "$3${x}",
+		},
+		"dollars": {
+			givenRe:       `\d+`,
+			givenStr:      "costs 5 or 10",
+			givenTemplate: "$$$0 ${} $",
+		},
+		"empty matches": {
+			givenRe:       `x*`,
+			givenStr:      "axxbé",
+			givenTemplate: "-",
+		},
+		"unicode": {
+			givenRe:       `(é+)`,
+			givenStr:      "aééb",
+			givenTemplate: "<$1>",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			if d := cmp.Diff(goRe.ReplaceAllString(tt.givenStr, tt.givenTemplate), re.ReplaceAll(tt.givenStr, tt.givenTemplate)); d != "" {
+				t.Errorf("ReplaceAll: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.ReplaceAllLiteralString(tt.givenStr, tt.givenTemplate), re.ReplaceAllLiteral(tt.givenStr, tt.givenTemplate)); d != "" {
+				t.Errorf("ReplaceAllLiteral: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.ReplaceAllStringFunc(tt.givenStr, strings.ToUpper), re.ReplaceAllFunc(tt.givenStr, strings.ToUpper)); d != "" {
+				t.Errorf("ReplaceAllFunc: got diff (-want +got):\n%s", d)
+			}
+			var want, got []byte
+			for _, match := range goRe.FindAllStringSubmatchIndex(tt.givenStr, -1) {
+				want = goRe.ExpandString(want, tt.givenTemplate, tt.givenStr, match)
+				got = re.Expand(got, tt.givenTemplate, tt.givenStr, match)
+			}
+			if d := cmp.Diff(string(want), string(got)); d != "" {
+				t.Errorf("Expand: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestReplaceCaseConversion(t *testing.T) {
+	tests := map[string]struct {
+		givenRe       string
+		givenStr      string
+		givenTemplate string
+		wantReplaced  string
+	}{
+		"upper case a numbered group": {
+			givenRe:       `(\w+)_(\w+)`,
+			givenStr:      "snake_case",
+			givenTemplate: `\U$1\E_$2`,
+			wantReplaced:  "SNAKE_case",
+		},
+		"upper case until the end": {
+			givenRe:       `(\w+)_(\w+)`,
+			givenStr:      "snake_case",
+			givenTemplate: `\U$1_$2`,
+			wantReplaced:  "SNAKE_CASE",
+		},
+		"capitalise a named group": {
+			givenRe:       `get_(?P<field>\w+)`,
+			givenStr:      "get_name, get_age",
+			givenTemplate: `get\u${field}`,
+			wantReplaced:  "getName, getAge",
+		},
+		"lower case the first character": {
+			givenRe:       `(\w+)`,
+			givenStr:      "Hello World",
+			givenTemplate: `\l$1`,
+			wantReplaced:  "hello world",
+		},
+		"one-shot conversion inside a span": {
+			givenRe:       `(\w+) (\w+)`,
+			givenStr:      "jOHN sMITH",
+			givenTemplate: `\L\u$1 \u$2`,
+			wantReplaced:  "John Smith",
+		},
+		"conversions apply to the template text": {
+			givenRe:       `(?P<n>\d+)`,
+			givenStr:      "item 7",
+			givenTemplate: `\Uno.${n}x\E y`,
+			wantReplaced:  "item NO.7X y",
+		},
+		"switching between spans": {
+			givenRe:       `(\w+)-(\w+)`,
+			givenStr:      "Ab-Cd",
+			givenTemplate: `\L$1\U$2\E$1`,
+			wantReplaced:  "abCDAb",
+		},
+		"one-shot conversion carries over an empty group": {
+			givenRe:       `(x?)(\w+)`,
+			givenStr:      "abc",
+			givenTemplate: `\u$1$2`,
+			wantReplaced:  "Abc",
+		},
+		"unicode": {
+			givenRe:       `(\pL+)`,
+			givenStr:      "éclair über",
+			givenTemplate: `\u$1`,
+			wantReplaced:  "Éclair Über",
+		},
+		"escaped and other backslashes": {
+			givenRe:       `(a)`,
+			givenStr:      "a",
+			givenTemplate: `\\U\n$1\`,
+			wantReplaced:  `\U\na\`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			gotReplaced := re.ReplaceAll(tt.givenStr, tt.givenTemplate)
+
+			// then
+			if d := cmp.Diff(tt.wantReplaced, gotReplaced); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := map[string]struct {
+		givenRe  string
+		givenStr string
+	}{
+		"no match": {
+			givenRe:  `,`,
+			givenStr: "abc",
+		},
+		"separators": {
+			givenRe:  `\r?\n|;`,
+			givenStr: "a\r\nb;c\nd;",
+		},
+		"separator at the start": {
+			givenRe:  `;+`,
+			givenStr: ";;a;;b",
+		},
+		"empty matches": {
+			givenRe:  `x*`,
+			givenStr: "axxbc",
+		},
+		"empty pattern": {
+			givenRe:  ``,
+			givenStr: "abc",
+		},
+		"empty pattern and string": {
+			givenRe:  ``,
+			givenStr: "",
+		},
+		"empty string": {
+			givenRe:  `a`,
+			givenStr: "",
+		},
+		"unicode": {
+			givenRe:  `é|\s+`,
+			givenStr: "aébü  c",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			for _, n := range []int{-1, 0, 1, 2, 3} {
+				if d := cmp.Diff(goRe.Split(tt.givenStr, n), re.Split(tt.givenStr, n)); d != "" {
+					t.Errorf("Split with n %d: got diff (-want +got):\n%s", n, d)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitFunc(t *testing.T) {
+	tests := map[string]struct {
+		givenRe  string
+		givenStr string
+		want     []string
+	}{
+		"no delimiter": {
+			givenRe:  `;`,
+			givenStr: "abc",
+			want:     []string{"abc"},
+		},
+		"irregular delimiters": {
+			givenRe:  `\r?\n|;`,
+			givenStr: "a\r\nb;c\nd",
+			want:     []string{"a", "b", "c", "d"},
+		},
+		"no final empty token": {
+			givenRe:  `\r?\n`,
+			givenStr: "a\r\n\r\nb\r\n",
+			want:     []string{"a", "", "b"},
+		},
+		"greedy delimiter across reads": {
+			givenRe:  `;+`,
+			givenStr: ";;a;;;b",
+			want:     []string{"", "a", "b"},
+		},
+		"empty delimiters": {
+			givenRe:  `x*`,
+			givenStr: "axxbc",
+			want:     []string{"a", "b", "c"},
+		},
+		"unicode": {
+			givenRe:  `é`,
+			givenStr: "aébéüé",
+			want:     []string{"a", "b", "ü"},
+		},
+		"empty input": {
+			givenRe:  `;`,
+			givenStr: "",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			re, err := Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("our Compile: %v", err)
+			}
+
+			for _, r := range []io.Reader{strings.NewReader(tt.givenStr), iotest.OneByteReader(strings.NewReader(tt.givenStr))} {
+				// when
+				sc := bufio.NewScanner(r)
+				sc.Split(re.SplitFunc())
+				var got []string
+				for sc.Scan() {
+					got = append(got, sc.Text())
+				}
+
+				// then
+				if sc.Err() != nil {
+					t.Fatalf("Err: %v", sc.Err())
+				}
+				if d := cmp.Diff(tt.want, got); d != "" {
+					t.Errorf("got diff (-want +got):\n%s", d)
+				}
+			}
+		})
+	}
+}
+
+func TestFindAllSubmatches(t *testing.T) {
+	tests := map[string]struct {
+		givenRe        string
+		givenString    string
+		wantSubmatches [][]Submatch
+	}{
+
+		"happy bananas": {
+			givenRe:     "ba(.{0,2})na",
+			givenString: "anbananaortwobananasbaxana",
+		},
+		"multiline - dotall and groups": {
+			givenRe: `BEGIN\n(.*)\nEND`,
+			givenString: `Some preamble
+BEGIN
+  Line 1 of content
+  Line 2 of content
+END
+Some postamble`,
+		},
+		"nested groups - json like structure": {
+			givenRe:     `\{\s*"id":\s*(\d+),\s*"data":\s*"([^"]*)"\s*\}`,
+			givenString: `Before {"id": 123, "data": "hello"} after {"id": 456, "data": "world"} end`,
+		},
+		"nested groups - path segments": {
+			givenRe:     `(/(\w+))+`,
+			givenString: `/usr/local/bin/my_app /var/log/app.log`,
+		},
+		"complex nested groups with different character sets": {
+			givenRe:     `\[(\w+):(<([^>]+)>)?\]`,
+			givenString: `[Config: <Setting1>] [Type: <Boolean>] [Name: ]`,
+		},
+		"capture empty groups": {
+			givenRe:     `(a)?(b)?c`,
+			givenString: `abc ac bc c`,
+		},
+		"lazy quoted strings": {
+			givenRe:     `"(.*?)"`,
+			givenString: `key="value" other="" last="x y"`,
+		},
+		"greedy quoted strings": {
+			givenRe:     `"(.*)"`,
+			givenString: `key="value" other="" last="x y"`,
+		},
+		"multi-line anchors": {
+			givenRe:     `(?m)^(\w+):$`,
+			givenString: "key:\nvalue\nother:\n",
+		},
+		"text anchors": {
+			givenRe:     `(?i)^(\w+):$`,
+			givenString: "KEY:\nvalue\nother:",
+		},
+		"anchors in groups with multi-line": {
+			givenRe:     `(?m)(^\w|\w$)`,
+			givenString: "ab\ncd\ne",
+		},
+		"scoped multi-line anchors": {
+			givenRe:     `(?m:^x)|y$`,
+			givenString: "x\nxy\ny",
+		},
+		"word boundaries": {
+			givenRe:     `\b\w`,
+			givenString: "hello big_world, 42 times",
+		},
+		"non word boundaries": {
+			givenRe:     `\B`,
+			givenString: "ab c",
+		},
+		"unicode empty matches between runes": {
+			givenRe:     `x*`,
+			givenString: `äxöx€`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			gotSubmatches := re.FindAllSubmatches(tt.givenString, -1)
+
+			var gotSubmatchesStrings [][]string
+			for _, match := range gotSubmatches {
+				var submatchStrings []string
+				for _, sm := range match {
+					submatchStrings = append(submatchStrings, sm.Str)
+				}
+				gotSubmatchesStrings = append(gotSubmatchesStrings, submatchStrings)
+			}
+
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+			wantMatchesStrings := goRe.FindAllStringSubmatch(tt.givenString, -1)
+
+			// then
+			if d := cmp.Diff(wantMatchesStrings, gotSubmatchesStrings); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestIterators(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+	}{
+		"no match": {
+			givenRe:     `x+`,
+			givenString: "abc",
+		},
+		"groups": {
+			givenRe:     `(\w+)@(\w+)\.(com|org)?`,
+			givenString: "mail a@b.com or xy@z.org and q@r.",
+		},
+		"empty matches": {
+			givenRe:     `(x)*`,
+			givenString: "axxbx",
+		},
+		"unicode": {
+			givenRe:     `(é)|(ü+)`,
+			givenString: "aéüüb",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			re, err := Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("our Compile: %v", err)
+			}
+
+			// when
+			var gotMatches [][]Submatch
+			for i, match := range re.All(tt.givenString) {
+				if i != len(gotMatches) {
+					t.Errorf("All: want index %d, got %d", len(gotMatches), i)
+				}
+				if match.Offset != match.Submatches[0].Offset || match.Str != match.Submatches[0].Str {
+					t.Errorf("All: match %+v differs from its group 0", match)
+				}
+				gotMatches = append(gotMatches, match.Submatches)
+			}
+			gotIndex := slices.Collect(re.AllIndex(tt.givenString))
+			gotIndexBytes := slices.Collect(re.AllIndexBytes([]byte(tt.givenString)))
+
+			// then
+			if d := cmp.Diff(re.FindAllSubmatches(tt.givenString, -1), gotMatches); d != "" {
+				t.Errorf("All: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(re.FindAllSubmatchIndex(tt.givenString, -1), gotIndex); d != "" {
+				t.Errorf("AllIndex: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(re.FindAllSubmatchIndex(tt.givenString, -1), gotIndexBytes); d != "" {
+				t.Errorf("AllIndexBytes: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestIteratorsStopEarly(t *testing.T) {
+	// given
+	re, err := Compile(`\d+`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	given := "1 22 333 4444"
+
+	// when
+	var gotAll []string
+	for i, match := range re.All(given) {
+		gotAll = append(gotAll, match.Str)
+		if i == 1 {
+			break
+		}
+	}
+	var gotIndex [][]int
+	for match := range re.AllIndex(given) {
+		gotIndex = append(gotIndex, match)
+		break
+	}
+
+	// then
+	if d := cmp.Diff([]string{"1", "22"}, gotAll); d != "" {
+		t.Errorf("All: got diff (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([][]int{{0, 1}}, gotIndex); d != "" {
+		t.Errorf("AllIndex: got diff (-want +got):\n%s", d)
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	tests := map[string]struct {
+		givenRe string
+	}{
+		"empty":                   {givenRe: ``},
+		"literal":                 {givenRe: `abc`},
+		"literal in a group":      {givenRe: `(?:ab)(cd)`},
+		"repeated literal":        {givenRe: `a{2}b`},
+		"quantifier at the end":   {givenRe: `abc+`},
+		"optional first char":     {givenRe: `x?abc`},
+		"alternation":             {givenRe: `ab(c|d)`},
+		"class":                   {givenRe: `ERROR: \d+`},
+		"anchors":                 {givenRe: `^abc`},
+		"case-insensitive":        {givenRe: `(?i)abc`},
+		"case-insensitive digits": {givenRe: `(?i)12k`},
+		"unicode":                 {givenRe: `éü+`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+			gotPrefix, gotComplete := re.LiteralPrefix()
+
+			// then
+			wantPrefix, wantComplete := goRe.LiteralPrefix()
+			if wantPrefix != gotPrefix || wantComplete != gotComplete {
+				t.Errorf("want (%q, %v), got (%q, %v)", wantPrefix, wantComplete, gotPrefix, gotComplete)
+			}
+		})
+	}
+}
+
+func TestPrefilter(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+	}{
+		"prefix": {
+			givenRe:     `ERROR: (\d+)`,
+			givenString: "INFO: 1\nERROR: 22\nERROR: x ERROR: 333",
+		},
+		"overlapping prefix candidates": {
+			givenRe:     `aab`,
+			givenString: "aaaabaab",
+		},
+		"inner literal with bounded distance": {
+			givenRe:     `\w{1,3}@example`,
+			givenString: "mail alice@example and bo@example, @example",
+		},
+		"inner literal with unbounded distance": {
+			givenRe:     `[a-z]+-(\d+)x*-end`,
+			givenString: "ab-12-en cd-3xx-end e-4-end",
+		},
+		"inner literal that doesn't occur": {
+			givenRe:     `\d+kg`,
+			givenString: "12 kg, 3 g",
+		},
+		"first bytes": {
+			givenRe:     `[éx]\d|ü`,
+			givenString: "a1 é2 x3 ü ée",
+		},
+		"case-insensitive first bytes": {
+			givenRe:     `(?i)k\d`,
+			givenString: "a k1 K2 \u212a3",
+		},
+		"lookbehind and word boundaries": {
+			givenRe:     `\bfoo\b`,
+			givenString: "foobar foo barfoo foo",
+		},
+		"invalid UTF-8": {
+			givenRe:     "a\uFFFD|é+",
+			givenString: "a\xff \xc3\xa9\xc3 é\xe9 a\xe2\x82",
+		},
+		"multiline anchors": {
+			givenRe:     `(?m)^ab`,
+			givenString: "ab\nxab\nab",
+		},
+		"literal alternation": {
+			givenRe:     `(funcA|funcB|helper)\(`,
+			givenString: "x := funcA(1) + funcC(2) + helper(funcB(3))",
+		},
+		"overlapping literals": {
+			givenRe:     `abcd|bc|cdx`,
+			givenString: "abcdx abcx bcdx",
+		},
+		"literals sharing prefixes": {
+			givenRe:     `(?:ab|abc|abcde)(\d)`,
+			givenString: "abcd1 abc2 abcde3 ab4",
+		},
+		"alternation with assertions": {
+			givenRe:     `\b(?:foo|ba[rz])\b`,
+			givenString: "foobar foo barbaz baz bar",
+		},
+		"unicode alternation": {
+			givenRe:     `é+|ü|日本`,
+			givenString: "aééb日本語ü",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(tt.givenString, -1), re.FindAllSubmatchIndex(tt.givenString, -1)); d != "" {
+				t.Errorf("FindAllSubmatchIndex: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.FindAllSubmatchIndex([]byte(tt.givenString), -1), re.FindAllSubmatchIndexBytes([]byte(tt.givenString), -1)); d != "" {
+				t.Errorf("FindAllSubmatchIndexBytes: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestLargeLiteralAlternation(t *testing.T) {
+	// given
+	var names []string
+	for i := range 300 {
+		names = append(names, fmt.Sprintf("func%d", i*7))
+	}
+	givenRe := `\b(` + strings.Join(names, "|") + `)\(([a-z]*)\)`
+	var given strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&given, "call func%d(x) and func%d() ", i, i*3)
+	}
+
+	// when
+	re, gotErr := Compile(givenRe)
+	if gotErr != nil {
+		t.Fatalf("our Compile: %v", gotErr)
+	}
+	goRe, err := regexp.Compile(givenRe)
+	if err != nil {
+		t.Fatalf("golang Compile: %v", err)
+	}
+
+	// then
+	if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(given.String(), -1), re.FindAllSubmatchIndex(given.String(), -1)); d != "" {
+		t.Errorf("got diff (-want +got):\n%s", d)
+	}
+}
+
+func TestDFA(t *testing.T) {
+	tests := map[string]struct {
+		givenRe      string
+		givenStrings []string
+	}{
+		"literal": {
+			givenRe:      `abc`,
+			givenStrings: []string{"", "abc", "xxabcxx", "ab", "abab"},
+		},
+		"alternation and repetition": {
+			givenRe:      `(a|ab)(c|bcd)+`,
+			givenStrings: []string{"abcd", "abcbcd", "ac", "ab", "xabcdbcdx"},
+		},
+		"lazy repetition": {
+			givenRe:      `a.*?b`,
+			givenStrings: []string{"aXbXb", "a", "b", "ba"},
+		},
+		"empty matches": {
+			givenRe:      `x*`,
+			givenStrings: []string{"", "abc", "xx"},
+		},
+		"anchors": {
+			givenRe:      `(?m)^a+$`,
+			givenStrings: []string{"a", "ba\naa\n", "ab", "\n\n"},
+		},
+		"word boundaries": {
+			givenRe:      `\bis\b`,
+			givenStrings: []string{"this is", "island", "is", "his"},
+		},
+		"unicode": {
+			givenRe:      `[à-ÿ]+ü|日本`,
+			givenStrings: []string{"aéüb", "日本語", "ü", "\xff\xc3ü"},
+		},
+		"case folding": {
+			givenRe:      `(?i)straße`,
+			givenStrings: []string{"STRASSE", "Straße", "STRAẞE"},
+		},
+		"no match possible": {
+			givenRe:      `a[^\x00-\x{10FFFF}]`,
+			givenStrings: []string{"", "a", "ab"},
+		},
+		"match that could start before the previous one ended": {
+			givenRe:      `\w+?`,
+			givenStrings: []string{"abc", "a bc"},
+		},
+		"assertions at both ends": {
+			givenRe:      `\b\w+\b|(?m)^$`,
+			givenStrings: []string{"foo bar", "\n\nfoo\n", "é x"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			for _, s := range tt.givenStrings {
+				if want, got := goRe.MatchString(s), re.Match(s); want != got {
+					t.Errorf("Match(%q): want %v, got %v", s, want, got)
+				}
+				if want, got := goRe.Match([]byte(s)), re.MatchBytes([]byte(s)); want != got {
+					t.Errorf("MatchBytes(%q): want %v, got %v", s, want, got)
+				}
+				if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(s, -1), re.FindAllSubmatchIndex(s, -1)); d != "" {
+					t.Errorf("FindAllSubmatchIndex(%q): got diff (-want +got):\n%s", s, d)
+				}
+				if d := cmp.Diff(goRe.FindAllStringIndex(s, -1), re.FindAllIndex(s, -1)); d != "" {
+					t.Errorf("FindAllIndex(%q): got diff (-want +got):\n%s", s, d)
+				}
+				if d := cmp.Diff(goRe.FindAllIndex([]byte(s), -1), re.FindAllIndexBytes([]byte(s), -1)); d != "" {
+					t.Errorf("FindAllIndexBytes(%q): got diff (-want +got):\n%s", s, d)
+				}
+
+				m := newMachine(re.prog)
+				wantStart, wantEnd := -1, -1
+				if loc := goRe.FindStringIndex(s); loc != nil {
+					wantStart, wantEnd = loc[0], loc[1]
+				}
+				gotEnd, ok := m.dfa.search(inputString(s), inputString(s), 0, false)
+				if !ok || gotEnd != wantEnd {
+					t.Errorf("DFA search(%q): want %d, got %d (ok %v)", s, wantEnd, gotEnd, ok)
+				}
+				if gotEnd < 0 {
+					continue
+				}
+				if gotStart, ok := m.reverseDFA.searchReverse(inputString(s), gotEnd, 0); !ok || gotStart != wantStart {
+					t.Errorf("reverse DFA search(%q): want %d, got %d (ok %v)", s, wantStart, gotStart, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestDFACacheOverflow(t *testing.T) {
+	// given
+	// the DFA needs a state for every combination of the last 13 characters
+	givenRe := `(a|b)*a(a|b){12}c`
+	var given strings.Builder
+	x := uint32(1)
+	for range 200000 {
+		x = x*1664525 + 1013904223
+		given.WriteByte("ab"[x>>31])
+	}
+	given.WriteString("c")
+
+	// when
+	re, gotErr := Compile(givenRe)
+	if gotErr != nil {
+		t.Fatalf("our Compile: %v", gotErr)
+	}
+	goRe, err := regexp.Compile(givenRe)
+	if err != nil {
+		t.Fatalf("golang Compile: %v", err)
+	}
+	_, ok := newMachine(re.prog).dfa.search(inputString(given.String()), inputString(given.String()), 0, false)
+
+	// then
+	if ok {
+		t.Errorf("expected the DFA to give up")
+	}
+	if want, got := goRe.MatchString(given.String()), re.Match(given.String()); want != got {
+		t.Errorf("Match: want %v, got %v", want, got)
+	}
+	if d := cmp.Diff(goRe.FindStringIndex(given.String()), re.FindIndex(given.String())); d != "" {
+		t.Errorf("FindIndex: got diff (-want +got):\n%s", d)
+	}
+}
+
+func TestOnePass(t *testing.T) {
+	tests := map[string]struct {
+		givenRe      string
+		givenStrings []string
+		wantOnePass  bool
+	}{
+		"date": {
+			givenRe:      `^(\d{4})-(\d{2})-(\d{2})$`,
+			givenStrings: []string{"2024-01-31", "2024-01-31x", "x2024-01-31", "2024-1-31", ""},
+			wantOnePass:  true,
+		},
+		"repetition decided by the next rune": {
+			givenRe:      `^(?:(a)|(b))*c`,
+			givenStrings: []string{"abac", "c", "abx", "cab"},
+			wantOnePass:  true,
+		},
+		"optional groups": {
+			givenRe:      `^x(\w+)(?:@(\w+))?$`,
+			givenStrings: []string{"xab@cd", "xab", "xab@", "ab@cd"},
+			wantOnePass:  true,
+		},
+		"unicode and word boundaries": {
+			givenRe:      `^(é+)\b ([^ ]*)$`,
+			givenStrings: []string{"éé ab", "é ", "éa b"},
+			wantOnePass:  true,
+		},
+		"empty": {
+			givenRe:      `^$`,
+			givenStrings: []string{"", "a"},
+			wantOnePass:  true,
+		},
+		"not anchored": {
+			givenRe:      `(\d+)-(\d+)`,
+			givenStrings: []string{"12-34"},
+		},
+		"multiline anchor": {
+			givenRe:      `(?m)^(\d+)$`,
+			givenStrings: []string{"12\n34"},
+		},
+		"ambiguous alternation": {
+			givenRe:      `^(a|ab)(c|bcd)$`,
+			givenStrings: []string{"abcd", "ac"},
+		},
+		"match competing with the next rune": {
+			givenRe:      `^(a+)`,
+			givenStrings: []string{"aaa", "b"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			if got := re.prog.onePass != nil; got != tt.wantOnePass {
+				t.Errorf("one-pass: want %v, got %v", tt.wantOnePass, got)
+			}
+			for _, s := range tt.givenStrings {
+				if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(s, -1), re.FindAllSubmatchIndex(s, -1)); d != "" {
+					t.Errorf("FindAllSubmatchIndex(%q): got diff (-want +got):\n%s", s, d)
+				}
+				if want, got := goRe.MatchString(s), re.Match(s); want != got {
+					t.Errorf("Match(%q): want %v, got %v", s, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoisedBacktracker(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+		wantMemo    bool
+	}{
+		"nested repetition over a short run": {
+			// the b keeps the prefilter and the backtracker from skipping the input, but can't complete a match
+			givenRe:     `(a*)*b$`,
+			givenString: strings.Repeat("a", 40) + "bx",
+			wantMemo:    true,
+		},
+		"nested repetition with a match": {
+			givenRe:     `(a*)*b`,
+			givenString: strings.Repeat("a", 40) + "b",
+			wantMemo:    true,
+		},
+		"alternation of overlapping branches": {
+			givenRe:     `(a|aa)+$`,
+			givenString: strings.Repeat("a", 41) + "c",
+			wantMemo:    true,
+		},
+		"long input is handed to the pike VM": {
+			givenRe:     `(a*)*b`,
+			givenString: strings.Repeat("a", 100000),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// every instruction is executed at most once per position and reached from at most two others
+			m := newMachine(re.prog)
+			m.startBudget(Budget{Steps: 2 * len(re.prog.insts) * (len(tt.givenString) + 1)})
+
+			// when
+			gotMemo := m.canMemoise(inputString(tt.givenString))
+			got := re.FindAllSubmatchIndex(tt.givenString, -1)
+
+			// then
+			if gotMemo != tt.wantMemo {
+				t.Errorf("canMemoise: want %v, got %v", tt.wantMemo, gotMemo)
+			}
+			if gotMemo {
+				m.backtrack(inputString(tt.givenString), 0)
+				if m.err != nil {
+					t.Errorf("expected the backtracker to stay within %d steps, got %v", m.budget.Steps, m.err)
+				}
+			}
+			if d := cmp.Diff(goRe.FindAllStringSubmatchIndex(tt.givenString, -1), got); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestMatchContext(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+		givenBudget Budget
+		givenCancel bool
+		want        bool
+		wantErr     error
+	}{
+		"no budget": {
+			givenRe:     `(a|aa)*\1c`,
+			givenString: strings.Repeat("a", 10) + "c",
+			want:        true,
+		},
+		"enough steps": {
+			givenRe:     `\d+-\d+`,
+			givenString: "abc 12-34",
+			givenBudget: Budget{Steps: 1000},
+			want:        true,
+		},
+		"exponential backtracking runs out of steps": {
+			givenRe:     `(a|aa)*\1c`,
+			givenString: strings.Repeat("a", 40) + "xc",
+			givenBudget: Budget{Steps: 100000},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"long input runs out of steps": {
+			givenRe:     `a.*b`,
+			givenString: "a" + strings.Repeat("x", 100000),
+			givenBudget: Budget{Steps: 10000},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"backtracking stack runs out of memory": {
+			givenRe:     `(a*)\1b`,
+			givenString: strings.Repeat("a", 20000) + "xb",
+			givenBudget: Budget{Memory: 4096},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"small search runs out of memory": {
+			givenRe:     `a+b`,
+			givenString: "aaab",
+			givenBudget: Budget{Memory: 1},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"small backtracking search runs out of memory": {
+			givenRe:     `(a)\1b`,
+			givenString: "aab",
+			givenBudget: Budget{Memory: 1},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"enough memory": {
+			givenRe:     `(a)\1b`,
+			givenString: "aab",
+			givenBudget: Budget{Memory: 1 << 20},
+			want:        true,
+		},
+		"look-around runs out of steps": {
+			givenRe:     `(?=(a*)*c)`,
+			givenString: strings.Repeat("a", 12000),
+			givenBudget: Budget{Steps: 1000},
+			wantErr:     ErrBudgetExceeded,
+		},
+		"cancelled context": {
+			givenRe:     `a`,
+			givenString: "a",
+			givenCancel: true,
+			wantErr:     context.Canceled,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.givenCancel {
+				cancel()
+			}
+
+			// when
+			got, gotErr := re.WithBudget(tt.givenBudget).MatchContext(ctx, tt.givenString)
+
+			// then
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("want error %v, got %v", tt.wantErr, gotErr)
+			}
+			if got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchContextDeadline(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+	}{
+		"exponential backtracking": {
+			givenRe:     `(a|aa)*\1c`,
+			givenString: strings.Repeat("a", 60) + "xc",
+		},
+		"quadratic look-around": {
+			givenRe:     `(?=(a*)*c)`,
+			givenString: strings.Repeat("a", 12000),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given
+			re, err := Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("our Compile: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			// when
+			start := time.Now()
+			_, gotErr := re.MatchContext(ctx, tt.givenString)
+			elapsed := time.Since(start)
+
+			// then
+			if !errors.Is(gotErr, context.DeadlineExceeded) {
+				t.Errorf("want error %v, got %v", context.DeadlineExceeded, gotErr)
+			}
+			if elapsed > 500*time.Millisecond {
+				t.Errorf("expected the search to stop soon after the deadline, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestMemoryBudgetIgnoresCachedStates(t *testing.T) {
+	// given
+	re, err := Compile(`[ab]*a[ab]{9}c`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	var warm strings.Builder
+	x := uint32(1)
+	for range 200000 {
+		x = x*1664525 + 1013904223
+		warm.WriteByte("ab"[x>>31])
+	}
+	limited := re.WithBudget(Budget{Memory: 256 << 10})
+
+	// when
+	// fills the cache of the pooled machine with states the budgeted search doesn't need
+	re.Match(warm.String())
+	got, gotErr := limited.MatchContext(context.Background(), "aaaaaaaaaaac")
+
+	// then
+	if gotErr != nil {
+		t.Errorf("want no error, got %v", gotErr)
+	}
+	if !got {
+		t.Errorf("expected a match")
+	}
+}
+
+func TestBudgetWithoutError(t *testing.T) {
+	// given
+	re, err := Compile(`a.*b`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	given := "a" + strings.Repeat("x", 100000) + "b"
+
+	// when
+	limited := re.WithBudget(Budget{Steps: 1000})
+	scanner := NewScanner(limited, strings.NewReader(given))
+
+	// then
+	if limited.Match(given) {
+		t.Errorf("expected no match once the budget is exhausted")
+	}
+	if scanner.Scan() {
+		t.Errorf("expected the scanner to stop")
+	}
+	if !errors.Is(scanner.Err(), ErrBudgetExceeded) {
+		t.Errorf("want scanner error %v, got %v", ErrBudgetExceeded, scanner.Err())
+	}
+	if !re.Match(given) {
+		t.Errorf("expected the budget to only apply to the copy")
+	}
+}
+
+func TestLookAroundDoesNotAllocate(t *testing.T) {
+	// given
+	re, err := Compile(`(?<=\$)\d+(?=\.|,)`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	// short inputs are searched by the backtracker, long ones by the pike VM
+	for _, n := range []int{20, 5000} {
+		var given input = inputString(strings.Repeat("cost 10 or 20, ", n) + "$30.")
+		m := newMachine(re.prog)
+		m.match(given, 0)
+
+		// when
+		got := testing.AllocsPerRun(10, func() {
+			m.match(given, 0)
+		})
+
+		// then
+		if got != 0 {
+			t.Errorf("%d repetitions: want no allocations, got %v", n, got)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := map[string]struct {
+		givenPatterns []string
+		givenString   string
+		wantMatches   []int
+	}{
+		"no pattern matches": {
+			givenPatterns: []string{`x+`, `\d`},
+			givenString:   "abc",
+		},
+		"some patterns match": {
+			givenPatterns: []string{`TODO`, `\bfmt\.Print`, `panic\(`, `\s+$`},
+			givenString:   "fmt.Println(x) // TODO ",
+			wantMatches:   []int{0, 1, 3},
+		},
+		"overlapping patterns": {
+			givenPatterns: []string{`ab`, `b+c`, `abc`, `^a`, `c$`},
+			givenString:   "abbc",
+			wantMatches:   []int{0, 1, 3, 4},
+		},
+		"empty pattern": {
+			givenPatterns: []string{`x`, ``},
+			givenString:   "abc",
+			wantMatches:   []int{1},
+		},
+		"backreferences": {
+			givenPatterns: []string{`(\w)\1`, `(a)\1`, `z`},
+			givenString:   "hello",
+			wantMatches:   []int{0},
+		},
+		"look-around": {
+			givenPatterns: []string{`(?<=é)b`, `a(?!b)`, `b(?=c)`},
+			givenString:   "ébab",
+			wantMatches:   []int{0},
+		},
+		"unicode": {
+			givenPatterns: []string{`日本`, `\p{Greek}+`, `ü$`},
+			givenString:   "日本語 αβ",
+			wantMatches:   []int{0, 1},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			set, err := CompileSet(tt.givenPatterns)
+			if err != nil {
+				t.Fatalf("CompileSet: %v", err)
+			}
+
+			// then
+			if d := cmp.Diff(tt.wantMatches, set.Matches(tt.givenString)); d != "" {
+				t.Errorf("Matches: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(tt.wantMatches, set.MatchesBytes([]byte(tt.givenString))); d != "" {
+				t.Errorf("MatchesBytes: got diff (-want +got):\n%s", d)
+			}
+			if want, got := len(tt.wantMatches) > 0, set.IsMatch(tt.givenString); want != got {
+				t.Errorf("IsMatch: want %v, got %v", want, got)
+			}
+			if set.Len() != len(tt.givenPatterns) {
+				t.Errorf("Len: want %d, got %d", len(tt.givenPatterns), set.Len())
+			}
+			var wantIndex [][]int
+			for i := range tt.givenPatterns {
+				wantIndex = append(wantIndex, set.Regex(i).FindIndex(tt.givenString))
+			}
+			if d := cmp.Diff(wantIndex, set.MatchesIndex(tt.givenString)); d != "" {
+				t.Errorf("MatchesIndex: got diff (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestCompileSetError(t *testing.T) {
+	// when
+	_, err := CompileSet([]string{`a`, `(b`})
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "pattern 1") {
+		t.Errorf("want an error for pattern 1, got %v", err)
+	}
+}
+
+func TestSubexp(t *testing.T) {
+	tests := map[string]struct {
+		givenRe string
+	}{
+		"no groups":        {givenRe: `abc`},
+		"unnamed groups":   {givenRe: `(a)(b(c))`},
+		"non-capturing":    {givenRe: `(?:a)(b)(?i:c)(?s)`},
+		"named groups":     {givenRe: `(?P<first>a)(b)(?P<third>c)`},
+		"named and nested": {givenRe: `(?P<outer>x(?P<inner>y)(?:z))`},
+		"only non-capture": {givenRe: `(?:(?:a)|b)`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			re, gotErr := Compile(tt.givenRe)
+			if gotErr != nil {
+				t.Fatalf("our Compile: %v", gotErr)
+			}
+
+			goRe, err := regexp.Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("golang Compile: %v", err)
+			}
+
+			// then
+			if d := cmp.Diff(goRe.NumSubexp(), re.NumSubexp()); d != "" {
+				t.Errorf("NumSubexp: got diff (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff(goRe.SubexpNames(), re.SubexpNames()); d != "" {
+				t.Errorf("SubexpNames: got diff (-want +got):\n%s", d)
+			}
+			for _, name := range append(goRe.SubexpNames(), "missing") {
+				if d := cmp.Diff(goRe.SubexpIndex(name), re.SubexpIndex(name)); d != "" {
+					t.Errorf("SubexpIndex(%q): got diff (-want +got):\n%s", name, d)
+				}
+			}
+		})
+	}
+}
+
+func TestScanner(t *testing.T) {
+	tests := map[string]struct {
+		givenRe     string
+		givenString string
+	}{
+		"no match": {
+			givenRe:     `x+`,
+			givenString: "abcabcabc",
+		},
+		"matches spanning chunks": {
+			givenRe:     `(\w+)@(\w+)\.com`,
+			givenString: "mail alice@example.com or bob@test.com, not carol@test.org",
+		},
+		"greedy match up to the end": {
+			givenRe:     `a+`,
+			givenString: "baaaaaaaaa",
+		},
+		"empty matches": {
+			givenRe:     `(x)*`,
+			givenString: "axxbxyy",
+		},
+		"unicode": {
+			givenRe:     `(é+)|ü`,
+			givenString: "aééébüüéc",
+		},
+		"anchors and word boundaries": {
+			givenRe:     `(?m)^\w+\b|\b\w+$`,
+			givenString: "ab cd\nef gh\nij",
+		},
+		"unbounded pattern": {
+			givenRe:     `a\w*z`,
+			givenString: "abbbbbbbz aaa abz az",
+		},
+		"lookaround": {
+			givenRe:     `(?<=é)\w+(?=!)`,
+			givenString: "éab! bc! écd!",
+		},
+		"backreference": {
+			givenRe:     `(\w)\1`,
+			givenString: "abccdeeffg",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			re, err := Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("our Compile: %v", err)
+			}
+			want := re.FindAllSubmatchIndex(tt.givenString, -1)
+
+			for _, chunkSize := range []int{1, 2, 3, 7, 1024} {
+				// when
+				s := NewScanner(re, strings.NewReader(tt.givenString))
+				s.SetChunkSize(chunkSize)
+				var got [][]int
+				var gotText []string
+				for s.Scan() {
+					got = append(got, s.SubmatchIndex())
+					gotText = append(gotText, string(s.Bytes()))
+				}
+
+				// then
+				if s.Err() != nil {
+					t.Fatalf("chunk size %d: Err: %v", chunkSize, s.Err())
+				}
+				if d := cmp.Diff(want, got); d != "" {
+					t.Errorf("chunk size %d: got diff (-want +got):\n%s", chunkSize, d)
+				}
+				var wantText []string
+				for _, match := range want {
+					wantText = append(wantText, tt.givenString[match[0]:match[1]])
+				}
+				if d := cmp.Diff(wantText, gotText); d != "" {
+					t.Errorf("chunk size %d: Bytes: got diff (-want +got):\n%s", chunkSize, d)
+				}
+			}
+		})
+	}
+}
+
+func TestScannerBoundedMemory(t *testing.T) {
+	tests := map[string]struct {
+		givenRe string
+	}{
+		"bounded pattern": {
+			givenRe: `ab{1,3}c`,
+		},
+		"unbounded pattern": {
+			givenRe: `a\w*c`,
+		},
+		"bounded pattern with lookbehind": {
+			givenRe: `(?<=x)ab`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given
+			re, err := Compile(tt.givenRe)
+			if err != nil {
+				t.Fatalf("our Compile: %v", err)
+			}
+			given := strings.Repeat("xyz ", 1<<16) + "xabc"
+
+			// when
+			s := NewScanner(re, strings.NewReader(given))
+			s.SetChunkSize(64)
+			var got [][]int
+			for s.Scan() {
+				got = append(got, s.Index())
+			}
+
+			// then
+			if d := cmp.Diff(re.FindAllIndex(given, -1), got); d != "" {
+				t.Errorf("got diff (-want +got):\n%s", d)
+			}
+			if c := cap(s.in.buf); c > 1024 {
+				t.Errorf("buffer grew to %d bytes", c)
+			}
+		})
+	}
+}
+
+func TestScannerReadError(t *testing.T) {
+	// given
+	re, err := Compile(`ab`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	wantErr := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("ab ab"), iotest.ErrReader(wantErr))
+
+	// when
+	s := NewScanner(re, r)
+	var got [][]int
+	for s.Scan() {
+		got = append(got, s.Index())
+	}
+
+	// then
+	if d := cmp.Diff([][]int{{0, 2}}, got); d != "" {
+		t.Errorf("got diff (-want +got):\n%s", d)
+	}
+	if !errors.Is(s.Err(), wantErr) {
+		t.Errorf("Err: want %v, got %v", wantErr, s.Err())
+	}
+	if s.Scan() {
+		t.Errorf("Scan after error: want false")
+	}
+}
+
+// run with -race
+func TestConcurrentUse(t *testing.T) {
+	// given
+	re, err := Compile(`(\w+)@(\w+)\.(com|org)( \[(\d+)\])?`)
+	if err != nil {
+		t.Fatalf("our Compile: %v", err)
+	}
+	givenStrings := []string{
+		"alice@example.com [1] bob@example.org",
+		"no address here",
+		"carol@test.org [42], dave@test.com [7] and eve@x.com",
+		"",
+	}
+	wantSubmatches := make([][][]Submatch, len(givenStrings))
+	wantReplaced := make([]string, len(givenStrings))
+	for i, s := range givenStrings {
+		wantSubmatches[i] = re.FindAllSubmatches(s, -1)
+		wantReplaced[i] = re.Replace(s, "$2:$1")
+	}
+
+	// when
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for g := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range 200 {
+				i := (g + n) % len(givenStrings)
+				if d := cmp.Diff(wantSubmatches[i], re.FindAllSubmatches(givenStrings[i], -1)); d != "" {
+					errs <- d
+					return
+				}
+				if d := cmp.Diff(wantReplaced[i], re.Replace(givenStrings[i], "$2:$1")); d != "" {
+					errs <- d
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// then
+	for d := range errs {
+		t.Errorf("got diff (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,195 @@
+package regex
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Replace returns a copy of s with the leftmost match replaced by the expansion of template, see Expand
+func (re Regex) Replace(s string, template string) string {
+	return re.replace(s, 1, func(dst []byte, match []int) []byte {
+		return re.Expand(dst, template, s, match)
+	})
+}
+
+// ReplaceAll returns a copy of s with all matches replaced by the expansion of template, see Expand
+func (re Regex) ReplaceAll(s string, template string) string {
+	return re.replace(s, -1, func(dst []byte, match []int) []byte {
+		return re.Expand(dst, template, s, match)
+	})
+}
+
+// ReplaceAllLiteral returns a copy of s with all matches replaced by repl, which is inserted as is
+func (re Regex) ReplaceAllLiteral(s string, repl string) string {
+	return re.replace(s, -1, func(dst []byte, match []int) []byte {
+		return append(dst, repl...)
+	})
+}
+
+// ReplaceAllFunc returns a copy of s with all matches replaced by the result of calling repl with the matched text
+func (re Regex) ReplaceAllFunc(s string, repl func(string) string) string {
+	return re.replace(s, -1, func(dst []byte, match []int) []byte {
+		return append(dst, repl(s[match[0]:match[1]])...)
+	})
+}
+
+// replace rewrites up to maxCount matches in s, keeping the text between them.
+// repl appends the replacement of the match to dst, match holds the offsets of the match and its groups
+func (re Regex) replace(s string, maxCount int, repl func(dst []byte, match []int) []byte) string {
+	var out []byte
+	lastMatchEnd := 0
+	replaced := false
+	re.allMatches(inputString(s), len(s), maxCount, func(caps []int) {
+		out = append(out, s[lastMatchEnd:caps[0]]...)
+		out = repl(out, caps)
+		lastMatchEnd = caps[1]
+		replaced = true
+	})
+	if !replaced {
+		return s
+	}
+	out = append(out, s[lastMatchEnd:]...)
+	return string(out)
+}
+
+// Expand appends template to dst, with references to groups replaced by the text they matched in src.
+// match holds the offsets of the match and its groups, as returned by FindSubmatchIndex.
+// $1 and ${1} refer to group 1, ${name} to the group with that name and $$ is a literal $.
+// references to groups that don't exist or did not take part in the match are replaced by the empty string,
+// a $ that does not start a valid reference is copied as is.
+//
+// the case of the text following \U, \L, \u and \l is converted, this applies to both the template and the
+// text of referenced groups. \U and \L convert everything up to the next \E, \U or \L to upper and lower case,
+// \u and \l only convert the next character. \\ is a literal backslash, other backslashes are copied as is
+func (re Regex) Expand(dst []byte, template string, src string, match []int) []byte {
+	var conv caseConversion
+	for {
+		i := strings.IndexAny(template, `$\`)
+		if i == -1 {
+			break
+		}
+		dst = conv.append(dst, template[:i])
+		special := template[i]
+		template = template[i+1:]
+
+		if special == '\\' {
+			if template == "" {
+				dst = conv.append(dst, `\`)
+				continue
+			}
+			switch template[0] {
+			case 'U':
+				conv.span = caseUpper
+			case 'L':
+				conv.span = caseLower
+			case 'E':
+				conv.span = caseKeep
+			case 'u':
+				conv.next = caseUpper
+			case 'l':
+				conv.next = caseLower
+			case '\\':
+				dst = conv.append(dst, `\`)
+			default:
+				// not an escape, the following character is copied on the next iteration
+				dst = conv.append(dst, `\`)
+				continue
+			}
+			template = template[1:]
+			continue
+		}
+
+		if strings.HasPrefix(template, "$") {
+			dst = conv.append(dst, "$")
+			template = template[1:]
+			continue
+		}
+		ref, rest, ok := parseGroupRef(template)
+		if !ok {
+			dst = conv.append(dst, "$")
+			continue
+		}
+		template = rest
+
+		group := re.SubexpIndex(ref)
+		if n, err := strconv.Atoi(ref); err == nil {
+			group = n
+		}
+		if group >= 0 && 2*group+1 < len(match) && match[2*group] >= 0 {
+			dst = conv.append(dst, src[match[2*group]:match[2*group+1]])
+		}
+	}
+	return conv.append(dst, template)
+}
+
+type caseMode uint8
+
+const (
+	caseKeep caseMode = iota
+	caseUpper
+	caseLower
+)
+
+// caseConversion is the state of the case conversion escapes while expanding a template
+type caseConversion struct {
+	// set by \U and \L, reset by \E
+	span caseMode
+	// set by \u and \l, only applies to the next rune and takes precedence over span
+	next caseMode
+}
+
+// append appends text to dst, converting its case as requested by the escapes seen so far
+func (c *caseConversion) append(dst []byte, text string) []byte {
+	if c.span == caseKeep && c.next == caseKeep {
+		return append(dst, text...)
+	}
+	for len(text) > 0 {
+		r, w := utf8.DecodeRuneInString(text)
+		mode := c.span
+		if c.next != caseKeep {
+			mode, c.next = c.next, caseKeep
+		}
+		switch {
+		case r == utf8.RuneError && w == 1:
+			// keep invalid UTF-8 as it is
+			dst = append(dst, text[0])
+		case mode == caseUpper:
+			dst = utf8.AppendRune(dst, unicode.ToUpper(r))
+		case mode == caseLower:
+			dst = utf8.AppendRune(dst, unicode.ToLower(r))
+		default:
+			dst = append(dst, text[:w]...)
+		}
+		text = text[w:]
+	}
+	return dst
+}
+
+// parseGroupRef parses the group reference at the start of template, right after the '$'.
+// the reference is either a group number, or a group number or name enclosed in braces
+func parseGroupRef(template string) (ref string, rest string, ok bool) {
+	if strings.HasPrefix(template, "{") {
+		end := strings.IndexByte(template, '}')
+		if end < 2 {
+			return "", "", false
+		}
+		ref = template[1:end]
+		for i := 0; i < len(ref); i++ {
+			if !isWordChar(rune(ref[i])) {
+				return "", "", false
+			}
+		}
+		return ref, template[end+1:], true
+	}
+
+	end := 0
+	for end < len(template) && '0' <= template[end] && template[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return "", "", false
+	}
+	return template[:end], template[end:], true
+}
@@ -0,0 +1,237 @@
+package regex
+
+import (
+	"io"
+	"math"
+	"slices"
+	"unicode/utf8"
+)
+
+// number of bytes a Scanner reads at once, unless changed with SetChunkSize
+const defaultChunkSize = 64 * 1024
+
+// Scanner finds successive, non-overlapping matches of a pattern in the text read from an io.Reader.
+// the text is read in chunks, matches spanning several chunks are found just like in a single string.
+// only the part of the text that can still be part of a match is kept in memory, which is bounded
+// if the pattern matches a bounded number of characters and contains no backreferences
+type Scanner struct {
+	re        Regex
+	r         io.Reader
+	chunkSize int
+	in        inputWindow
+	// byte offset at which the next search starts
+	pos          int
+	prevMatchEnd int
+	// bytes kept before pos for assertions looking back, and bytes after a start position a match can depend on
+	behindBytes int
+	reachBytes  int
+	match       []int
+	err         error
+	done        bool
+}
+
+// NewScanner returns a Scanner reporting the matches of re in the text read from r
+func NewScanner(re Regex, r io.Reader) *Scanner {
+	// one extra rune on each side for the context of zero-width assertions
+	return &Scanner{
+		re:           re,
+		r:            r,
+		chunkSize:    defaultChunkSize,
+		prevMatchEnd: -1,
+		behindBytes:  saturatingMul(saturatingAdd(re.prog.behind, 2), utf8.UTFMax),
+		reachBytes:   saturatingMul(saturatingAdd(re.prog.reach, 2), utf8.UTFMax),
+	}
+}
+
+// SetChunkSize sets the number of bytes read from the reader at once, it must be called before the first call to Scan
+func (s *Scanner) SetChunkSize(n int) {
+	if n < 1 {
+		panic("regex: chunk size must be positive")
+	}
+	s.chunkSize = n
+}
+
+// Scan advances to the next match, which is then available through Index, SubmatchIndex and Bytes.
+// it returns false once there are no more matches or reading failed, see Err
+func (s *Scanner) Scan() bool {
+	if s.done {
+		return false
+	}
+	m := s.re.getMachine()
+	defer s.re.putMachine(m)
+
+	for {
+		if s.in.eof && s.pos > s.in.base+len(s.in.buf) {
+			// the previous match was an empty one at the end of the text
+			s.done = true
+			return false
+		}
+		s.in.truncated = false
+		found := m.match(&s.in, s.pos)
+		if m.err != nil {
+			s.err = m.err
+			s.done = true
+			return false
+		}
+		if s.in.truncated {
+			// the result might change with more text
+			if !found {
+				s.skipTo(s.resumePos(m))
+			}
+			if !s.fill() {
+				return false
+			}
+			continue
+		}
+		if !found {
+			s.done = true
+			return false
+		}
+
+		start, end := m.matchcap[0], m.matchcap[1]
+		accept := true
+		if end == start {
+			// empty matches directly after a previous match are ignored
+			if start == s.prevMatchEnd {
+				accept = false
+			}
+			// move on to the next rune
+			w, ok := s.width(end)
+			if !ok {
+				return false
+			}
+			s.pos = end + max(w, 1)
+		} else {
+			s.pos = end
+		}
+		s.prevMatchEnd = end
+
+		if accept {
+			s.match = append(s.match[:0], m.matchcap...)
+			return true
+		}
+	}
+}
+
+// Index returns the start and end offset of the current match in the text read so far
+func (s *Scanner) Index() []int {
+	return []int{s.match[0], s.match[1]}
+}
+
+// SubmatchIndex returns the offsets of the current match and its groups, laid out like the result of FindSubmatchIndex
+func (s *Scanner) SubmatchIndex() []int {
+	return append([]int(nil), s.match...)
+}
+
+// Bytes returns the text of the current match. the slice is only valid until the next call to Scan
+func (s *Scanner) Bytes() []byte {
+	from, to := s.match[0]-s.in.base, s.match[1]-s.in.base
+	return s.in.buf[from:to:to]
+}
+
+// Err returns the first error returned by the reader, other than io.EOF, or ErrBudgetExceeded
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// width returns the width of the rune at pos, reading more text if needed
+func (s *Scanner) width(pos int) (int, bool) {
+	for {
+		s.in.truncated = false
+		_, w := s.in.step(pos)
+		if !s.in.truncated {
+			return w, true
+		}
+		if !s.fill() {
+			return 0, false
+		}
+	}
+}
+
+// resumePos returns the earliest position a match can start at after a search that found none in the text read so far
+func (s *Scanner) resumePos(m *machine) int {
+	if !s.re.prog.backrefs && len(s.re.prog.looks) == 0 {
+		// the pike VM knows the earliest start of a match that was still possible.
+		// look-around assertions may have failed for lack of text, so those patterns can't rely on it
+		return m.pending
+	}
+	if s.reachBytes == math.MaxInt {
+		return s.pos
+	}
+	// matches starting this far before the end would have been found without reading past it
+	return s.in.base + len(s.in.buf) - s.reachBytes
+}
+
+// skipTo moves the start of the next search forward rune by rune until it is at or after pos
+func (s *Scanner) skipTo(pos int) {
+	for s.pos < pos {
+		_, w := s.in.step(s.pos)
+		if w == 0 {
+			break
+		}
+		s.pos += w
+		// the skipped positions can't be the start of an empty match after the previous one
+		s.prevMatchEnd = -1
+	}
+}
+
+// fill drops the text that is no longer needed and reads the next chunk.
+// it returns false if reading failed
+func (s *Scanner) fill() bool {
+	if drop := s.pos - s.behindBytes - s.in.base; drop > 0 && s.behindBytes != math.MaxInt {
+		n := copy(s.in.buf, s.in.buf[drop:])
+		s.in.buf = s.in.buf[:n]
+		s.in.base += drop
+	}
+
+	n := len(s.in.buf)
+	s.in.buf = slices.Grow(s.in.buf, s.chunkSize)
+	read, err := io.ReadAtLeast(s.r, s.in.buf[n:n+s.chunkSize], 1)
+	s.in.buf = s.in.buf[:n+read]
+	switch {
+	case err == io.EOF:
+		s.in.eof = true
+	case err != nil:
+		s.err = err
+		s.done = true
+		return false
+	}
+	return true
+}
+
+// inputWindow is the part of a longer text that has been read so far, starting at the byte offset base.
+// positions are offsets into the whole text. truncated is set whenever the text beyond buf was needed,
+// in which case the result of a search may change once more of the text is read
+type inputWindow struct {
+	buf       []byte
+	base      int
+	eof       bool
+	truncated bool
+}
+
+func (in *inputWindow) step(pos int) (rune, int) {
+	i := pos - in.base
+	if i >= len(in.buf) {
+		if !in.eof {
+			in.truncated = true
+		}
+		return -1, 0
+	}
+	if c := in.buf[i]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	if !in.eof && !utf8.FullRune(in.buf[i:]) {
+		// the rest of the rune hasn't been read yet
+		in.truncated = true
+		return -1, 0
+	}
+	return utf8.DecodeRune(in.buf[i:])
+}
+
+func (in *inputWindow) before(pos int) (rune, int) {
+	i := pos - in.base
+	if i <= 0 {
+		return -1, 0
+	}
+	return utf8.DecodeLastRune(in.buf[:i])
+}
@@ -0,0 +1,218 @@
+package regex
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Set is a list of patterns that are matched against a text in a single pass, reporting which of them matched.
+// all patterns without backreferences are combined into one program, which is simulated without captures.
+// positions are only computed for the patterns that matched, using their own Regex
+type Set struct {
+	regexes []Regex
+	// the combined program, its instMatch instructions hold the index of their pattern in arg
+	prog *prog
+	// patterns with backreferences can't be simulated together and are matched one by one
+	backrefs []int
+	machines *sync.Pool
+}
+
+// setMachine holds the mutable state of a search of a Set
+type setMachine struct {
+	q0, q1  queue
+	matched []bool
+	looks   lookScratch
+}
+
+// CompileSet compiles all patterns into a Set, the patterns keep their index in the list
+func CompileSet(patterns []string) (Set, error) {
+	s := Set{}
+	combined := &prog{}
+	var starts []int
+	for i, expr := range patterns {
+		re, err := Compile(expr)
+		if err != nil {
+			return Set{}, fmt.Errorf("pattern %d: %w", i, err)
+		}
+		s.regexes = append(s.regexes, re)
+		if re.prog.backrefs {
+			s.backrefs = append(s.backrefs, i)
+			continue
+		}
+		starts = append(starts, combined.link(re.prog, i))
+	}
+
+	// try all patterns at every position, the order doesn't matter as there are no priorities
+	combined.start = len(combined.insts)
+	if len(starts) == 0 {
+		combined.insts = append(combined.insts, inst{op: instFail})
+	}
+	for j, start := range starts {
+		if j == len(starts)-1 {
+			combined.insts = append(combined.insts, inst{op: instNop, out: start})
+			break
+		}
+		next := len(combined.insts) + 1
+		combined.insts = append(combined.insts, inst{op: instAlt, out: start, arg: next})
+	}
+	s.prog = combined
+
+	n := len(patterns)
+	s.machines = &sync.Pool{
+		New: func() any {
+			return &setMachine{
+				q0:      newQueue(len(combined.insts)),
+				q1:      newQueue(len(combined.insts)),
+				matched: make([]bool, n),
+			}
+		},
+	}
+	return s, nil
+}
+
+// link appends the instructions of sub to p and returns the new position of its start.
+// the instMatch instructions of sub report the pattern index
+func (p *prog) link(sub *prog, index int) int {
+	offset, lookOffset := len(p.insts), len(p.looks)
+	for _, i := range sub.insts {
+		i.out += offset
+		switch i.op {
+		case instAlt:
+			i.arg += offset
+		case instLook:
+			i.arg += lookOffset
+		case instMatch:
+			i.arg = index
+		}
+		p.insts = append(p.insts, i)
+	}
+	p.looks = append(p.looks, sub.looks...)
+	return sub.start + offset
+}
+
+// Len returns the number of patterns in the set
+func (s Set) Len() int {
+	return len(s.regexes)
+}
+
+// Regex returns the compiled pattern with index i
+func (s Set) Regex(i int) Regex {
+	return s.regexes[i]
+}
+
+// IsMatch reports whether any of the patterns matches str
+func (s Set) IsMatch(str string) bool {
+	return len(s.matches(inputString(str), true)) > 0
+}
+
+// Matches returns the indices of the patterns that match str, in increasing order
+func (s Set) Matches(str string) []int {
+	return s.matches(inputString(str), false)
+}
+
+// MatchesBytes returns the indices of the patterns that match b, in increasing order
+func (s Set) MatchesBytes(b []byte) []int {
+	return s.matches(inputBytes(b), false)
+}
+
+// MatchesIndex returns the offsets of the leftmost match of every pattern in str, as returned by FindIndex.
+// the offsets of patterns that don't match are nil
+func (s Set) MatchesIndex(str string) [][]int {
+	all := make([][]int, len(s.regexes))
+	for _, i := range s.Matches(str) {
+		all[i] = s.regexes[i].FindIndex(str)
+	}
+	return all
+}
+
+func (s Set) matches(in input, stopAtFirst bool) []int {
+	m := s.machines.Get().(*setMachine)
+	defer s.machines.Put(m)
+	for i := range m.matched {
+		m.matched[i] = false
+	}
+
+	s.prog.matchSet(in, m, len(s.regexes)-len(s.backrefs), stopAtFirst)
+	for _, i := range s.backrefs {
+		if stopAtFirst && slices.Contains(m.matched, true) {
+			break
+		}
+		re := s.regexes[i]
+		rm := re.getMachine()
+		m.matched[i] = rm.match(in, 0)
+		re.putMachine(rm)
+	}
+
+	var indices []int
+	for i, matched := range m.matched {
+		if matched {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// matchSet simulates p without captures, starting at every position of in, and marks the patterns whose
+// instMatch is reached in m.matched. it stops once all numPatterns patterns matched, or at the first match if stopAtFirst is set
+func (p *prog) matchSet(in input, m *setMachine, numPatterns int, stopAtFirst bool) {
+	runq, nextq := &m.q0, &m.q1
+	runq.clear()
+	nextq.clear()
+	remaining := numPatterns
+
+	var add func(q *queue, pc, pos int, ctx emptyOp)
+	add = func(q *queue, pc, pos int, ctx emptyOp) {
+		if q.contains(pc) {
+			return
+		}
+		q.add(pc)
+
+		i := &p.insts[pc]
+		switch i.op {
+		case instNop, instSave, instProgress:
+			add(q, i.out, pos, ctx)
+		case instAlt:
+			add(q, i.out, pos, ctx)
+			add(q, i.arg, pos, ctx)
+		case instEmpty:
+			if emptyOp(i.arg)&^ctx == 0 {
+				add(q, i.out, pos, ctx)
+			}
+		case instLook:
+			if p.looks[i.arg].matches(in, pos, &m.looks) {
+				add(q, i.out, pos, ctx)
+			}
+		case instMatch:
+			if !m.matched[i.arg] {
+				m.matched[i.arg] = true
+				remaining--
+			}
+		}
+	}
+
+	pos := 0
+	before := rune(-1)
+	c, w := in.step(pos)
+	for {
+		add(runq, p.start, pos, emptyOpContext(before, c))
+		if remaining == 0 || stopAtFirst && remaining < numPatterns || w == 0 {
+			break
+		}
+
+		next, nextW := in.step(pos + w)
+		ctx := emptyOpContext(c, next)
+		for _, e := range runq.dense {
+			i := &p.insts[e.pc]
+			if (i.op == instChar || i.op == instBracket) && i.matches(c) {
+				add(nextq, i.out, pos+w, ctx)
+			}
+		}
+		runq.clear()
+		runq, nextq = nextq, runq
+		pos += w
+		before, c, w = c, next, nextW
+	}
+	runq.clear()
+	nextq.clear()
+}
@@ -0,0 +1,80 @@
+package regex
+
+import (
+	"bufio"
+)
+
+// Split slices s into the substrings between the matches of the pattern, like regexp.Regexp.Split.
+// n limits the number of substrings, the last one being the unsplit remainder. if n is 0 the result is nil,
+// if it is negative all substrings are returned
+func (re Regex) Split(s string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	if len(re.expr) > 0 && len(s) == 0 {
+		return []string{""}
+	}
+
+	matches := re.FindAllIndex(s, n)
+	substrings := make([]string, 0, len(matches))
+	beg, end := 0, 0
+	for _, match := range matches {
+		if n > 0 && len(substrings) == n-1 {
+			break
+		}
+		end = match[0]
+		// an empty match at the start doesn't split off an empty substring
+		if match[1] != 0 {
+			substrings = append(substrings, s[beg:end])
+		}
+		beg = match[1]
+	}
+	if end != len(s) {
+		substrings = append(substrings, s[beg:])
+	}
+	return substrings
+}
+
+// SplitFunc returns a bufio.SplitFunc that splits the input into the tokens between the matches of the pattern.
+// as with bufio.ScanLines, a delimiter at the very end of the input doesn't produce a final empty token.
+// every token is searched for on its own, so assertions at the start of a token can't see the preceding delimiter
+func (re Regex) SplitFunc() bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		m := re.getMachine()
+		defer re.putMachine(m)
+		in := &inputWindow{buf: data, eof: atEOF}
+		pos := 0
+		for {
+			found := m.match(in, pos)
+			if in.truncated {
+				// the delimiter could still change with more data
+				return 0, nil, nil
+			}
+			if !found {
+				break
+			}
+			if start, end := m.matchcap[0], m.matchcap[1]; end > 0 {
+				return end, data[:start], nil
+			}
+
+			// an empty delimiter at the start of the token doesn't split, try again from the next rune
+			_, w := in.step(0)
+			if in.truncated {
+				return 0, nil, nil
+			}
+			if w == 0 {
+				break
+			}
+			pos = w
+		}
+
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}